@@ -1,10 +1,14 @@
 package componenttests
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"net"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -58,7 +62,7 @@ func setupTest(t *testing.T) testF {
 
 func getData(conn net.Conn) ([]byte, error) {
 	var data []byte
-	if err := conn.SetReadDeadline(time.Now().Add(time.Microsecond * 100)); err != nil {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond * 5)); err != nil {
 		return data, err
 	}
 
@@ -70,6 +74,41 @@ func getData(conn net.Conn) ([]byte, error) {
 	return data, nil
 }
 
+var dateHeader = regexp.MustCompile("Date: [^\r]*\r\n")
+
+// withoutDate removes Date headers, which change with every response.
+func withoutDate(response string) string {
+	return dateHeader.ReplaceAllString(response, "")
+}
+
+// readResponse reads a single response framed with Content-Length.
+func readResponse(reader *bufio.Reader) (string, error) {
+	var response strings.Builder
+	contentLength := 0
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return response.String(), err
+		}
+		response.WriteString(line)
+
+		if value, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			contentLength, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	body := make([]byte, contentLength)
+	_, err := io.ReadFull(reader, body)
+	response.Write(body)
+
+	return response.String(), err
+}
+
 func TestServer(t *testing.T) {
 	f := setupTest(t)
 
@@ -81,7 +120,7 @@ func TestServer(t *testing.T) {
 		return nil, fmt.Errorf("some error")
 	})
 
-	requestInput := "POST / HTTP/1.1\r\n Host: localhost:4221\r\n User-Agent: curl/8.4.0\r\n Accept: */*\r\nContent-Length: 16\r\n Content-Type: application/json\r\n\r\n{\"test\":\"value\"}"
+	requestInput := "POST / HTTP/1.1\r\nHost: localhost:4221\r\nUser-Agent: curl/8.4.0\r\nAccept: */*\r\nContent-Length: 16\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n{\"test\":\"value\"}"
 
 	go f.sut.Run(f.ctx, f.listenerMock)
 
@@ -89,5 +128,512 @@ func TestServer(t *testing.T) {
 
 	data, err := getData(f.clientConn)
 	assert.Nil(t, err)
-	assert.Equal(t, []byte("HTTP/1.1 404 Not Found\r\n"), data)
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nConnection: close\r\nContent-Length: 0\r\nServer: go-simple-server\r\n\r\n", withoutDate(string(data)))
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("GET", "/test", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("unit test"))
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 9\r\nContent-Type: text/plain; charset=utf-8\r\nServer: go-simple-server\r\n\r\nunit test"
+	reader := bufio.NewReader(f.clientConn)
+
+	for i := 0; i < 2; i++ {
+		_, _ = f.clientConn.Write([]byte("GET /test HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+		response, err := readResponse(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedResponse, withoutDate(response))
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	f := setupTest(t)
+	f.sut.IdleTimeout = time.Millisecond
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	// server closes idle connection without sending anything
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+	assert.Empty(t, data)
+}
+
+func TestServerPipelining(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("GET", "/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 2)
+		_, _ = w.Write([]byte("slow"))
+	})
+	f.sut.AddHandler("GET", "/fast", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fast"))
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\nGET /fast HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	}()
+
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 4\r\nContent-Type: text/plain; charset=utf-8\r\nServer: go-simple-server\r\n\r\nslow" +
+		"HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 4\r\nContent-Type: text/plain; charset=utf-8\r\nServer: go-simple-server\r\n\r\nfast"
+	assert.Equal(t, expectedResponse, withoutDate(string(data)))
+}
+
+func TestServerUnreadBody(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("POST", "/ignore", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ignored"))
+	})
+	f.sut.AddHandler("POST", "/echo", func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(payload)
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("POST /ignore HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nfirstPOST /echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 6\r\nConnection: close\r\n\r\nsecond"))
+	}()
+
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "\r\n\r\nignoredHTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\nsecond"))
+}
+
+func TestServerBufferPayload(t *testing.T) {
+	f := setupTest(t)
+	f.sut.BufferPayload = true
+
+	f.sut.AddHandler("POST", "/echo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(r.Payload)
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("POST /echo HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n3\r\nabc\r\n3\r\ndef\r\n0\r\n\r\n"))
+	}()
+
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(withoutDate(string(data)), "Connection: close\r\nContent-Length: 6\r\nContent-Type: text/plain; charset=utf-8\r\nServer: go-simple-server\r\n\r\nabcdef"))
+}
+
+func TestServerBufferPayloadTruncated(t *testing.T) {
+	f := setupTest(t)
+	f.sut.BufferPayload = true
+	f.sut.BodyReadTimeout = time.Millisecond
+
+	f.sut.AddHandler("POST", "/echo", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called with truncated body")
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		// rest of the body never arrives
+		_, _ = f.clientConn.Write([]byte("POST /echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 16\r\n\r\n{\"test\":"))
+	}()
+
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 400 Bad Request\r\n"))
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\n400 Bad Request"))
+}
+
+func TestServerParseErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		request        string
+		expectedStatus string
+	}{
+		{
+			name:           "request line",
+			request:        "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			expectedStatus: "414 URI Too Long",
+		},
+		{
+			name:           "headers",
+			request:        "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+			expectedStatus: "431 Request Header Fields Too Large",
+		},
+		{
+			name:           "body",
+			request:        "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1048576\r\n\r\n",
+			expectedStatus: "413 Content Too Large",
+		},
+		{
+			name:           "malformed start line",
+			request:        "GET /path\r\n\r\n",
+			expectedStatus: "400 Bad Request",
+		},
+		{
+			name:           "malformed request target",
+			request:        "GET * HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			expectedStatus: "400 Bad Request",
+		},
+		{
+			name:           "missing host",
+			request:        "GET / HTTP/1.1\r\n\r\n",
+			expectedStatus: "400 Bad Request",
+		},
+		{
+			name:           "malformed proto",
+			request:        "GET / HTTP/one\r\n\r\n",
+			expectedStatus: "400 Bad Request",
+		},
+		{
+			name:           "unsupported proto",
+			request:        "GET / HTTP/2.0\r\n\r\n",
+			expectedStatus: "505 HTTP Version Not Supported",
+		},
+		{
+			name:           "unsupported transfer encoding",
+			request:        "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip\r\n\r\n",
+			expectedStatus: "501 Not Implemented",
+		},
+		{
+			name:           "unsupported expectation",
+			request:        "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nExpect: 200-ok\r\n\r\n",
+			expectedStatus: "417 Expectation Failed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := setupTest(t)
+			f.sut.Limits = http.ParserLimits{
+				MaxRequestLineBytes: 32,
+				MaxHeaders:          3,
+				MaxBodyBytes:        1024,
+			}
+
+			f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+			f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+				<-f.ctx.Done()
+				return nil, fmt.Errorf("some error")
+			})
+
+			go f.sut.Run(f.ctx, f.listenerMock)
+
+			go func() {
+				_, _ = f.clientConn.Write([]byte(tc.request))
+			}()
+
+			data, err := io.ReadAll(f.clientConn)
+			assert.Nil(t, err)
+			expectedResponse := "HTTP/1.1 " + tc.expectedStatus + "\r\n" +
+				"Connection: close\r\n" +
+				fmt.Sprintf("Content-Length: %d\r\n", len(tc.expectedStatus)) +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Server: go-simple-server\r\n\r\n" +
+				tc.expectedStatus
+			assert.Equal(t, expectedResponse, withoutDate(string(data)))
+		})
+	}
+}
+
+func TestServerCustomErrorHandler(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.ErrorHandler = func(w http.ResponseWriter, statusCode int, err error) {
+		_ = w.SetStatus(statusCode)
+		_, _ = w.Write([]byte("custom error page"))
+	}
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("GET /path\r\n\r\n"))
+	}()
+
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 400 Bad Request\r\n"))
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\ncustom error page"))
+}
+
+func TestServerStreaming(t *testing.T) {
+	f := setupTest(t)
+
+	flushed := make(chan struct{})
+
+	f.sut.AddHandler("GET", "/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		assert.True(t, ok, "ResponseWriter should implement Flusher")
+
+		_, _ = w.Write([]byte("first"))
+		_ = flusher.Flush()
+
+		// client has to see the first part before handler continues
+		<-flushed
+		_, _ = w.Write([]byte("second"))
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("GET /stream HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	}()
+
+	reader := bufio.NewReader(f.clientConn)
+
+	var head strings.Builder
+	for !strings.HasSuffix(head.String(), "\r\n\r\n") {
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		head.WriteString(line)
+	}
+	assert.Contains(t, head.String(), "Transfer-Encoding: chunked\r\n")
+
+	firstChunk := make([]byte, len("5\r\nfirst\r\n"))
+	_, err := io.ReadFull(reader, firstChunk)
+	assert.Nil(t, err)
+	assert.Equal(t, "5\r\nfirst\r\n", string(firstChunk))
+	close(flushed)
+
+	rest, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "6\r\nsecond\r\n0\r\n\r\n", string(rest))
+}
+
+func TestServerPanicWhileStreaming(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("GET", "/stream", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+		_ = w.(http.Flusher).Flush()
+
+		panic("unit test")
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("GET /stream HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	}()
+
+	// connection is closed without terminating chunk
+	data, err := io.ReadAll(f.clientConn)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\n5\r\nfirst\r\n"))
+}
+
+func TestServerExpectContinue(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("POST", "/upload", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 9\r\nExpect: 100-continue\r\nConnection: close\r\n\r\n"))
+	}()
+
+	reader := bufio.NewReader(f.clientConn)
+
+	interim, err := readResponse(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", interim)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("unit test"))
+	}()
+
+	response, err := readResponse(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 9\r\nContent-Type: text/plain; charset=utf-8\r\nServer: go-simple-server\r\n\r\nunit test", withoutDate(response))
+}
+
+func TestServerExpectContinueRejected(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("POST", "/upload", func(w http.ResponseWriter, r *http.Request) {
+		_ = w.SetStatus(http.StatusContentTooLarge)
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 9\r\nExpect: 100-continue\r\n\r\n"))
+	}()
+
+	// connection is closed right after the response, body is never sent
+	data, err := getData(f.clientConn)
+	assert.Nil(t, err)
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large\r\nConnection: close\r\nContent-Length: 0\r\nServer: go-simple-server\r\n\r\n", withoutDate(string(data)))
+}
+
+func TestServerIdleTimeoutNotAppliedToBody(t *testing.T) {
+	f := setupTest(t)
+	f.sut.IdleTimeout = 2 * time.Millisecond
+
+	f.sut.AddHandler("POST", "/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("POST /echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 6\r\nConnection: close\r\n\r\n"))
+
+		// the whole body takes longer than idle timeout to arrive
+		for _, part := range []string{"ab", "cd", "ef"} {
+			time.Sleep(1500 * time.Microsecond)
+			_, _ = f.clientConn.Write([]byte(part))
+		}
+	}()
+
+	response, err := readResponse(bufio.NewReader(f.clientConn))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(response, "\r\n\r\nabcdef"), response)
+}
+
+func TestServerHandlerClosesConnection(t *testing.T) {
+	f := setupTest(t)
+
+	f.sut.AddHandler("GET", "/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	go func() {
+		_, _ = f.clientConn.Write([]byte("GET /test HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	}()
+
+	// server closes the connection right after the response
+	data, err := getData(f.clientConn)
+	assert.Nil(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 0\r\nServer: go-simple-server\r\n\r\n", withoutDate(string(data)))
+}
+
+func TestServerIdleTimeoutSlowHandler(t *testing.T) {
+	f := setupTest(t)
+	f.sut.IdleTimeout = 2 * time.Millisecond
+
+	f.sut.AddHandler("GET", "/slow", func(w http.ResponseWriter, r *http.Request) {
+		// connection is not idle while the handler runs
+		time.Sleep(4 * time.Millisecond)
+		_, _ = w.Write([]byte("slow"))
+	})
+	f.sut.AddHandler("GET", "/fast", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fast"))
+	})
+
+	f.listenerMock.EXPECT().Accept().Return(f.serverConn, nil)
+	f.listenerMock.EXPECT().Accept().DoAndReturn(func() (net.Conn, error) {
+		<-f.ctx.Done()
+		return nil, fmt.Errorf("some error")
+	})
+
+	go f.sut.Run(f.ctx, f.listenerMock)
+
+	reader := bufio.NewReader(f.clientConn)
+
+	// the second request shows the connection outlived the slow handler
+	for _, path := range []string{"slow", "fast"} {
+		go func() {
+			_, _ = f.clientConn.Write([]byte("GET /" + path + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		}()
+
+		response, err := readResponse(reader)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"), response)
+		assert.True(t, strings.HasSuffix(response, "\r\n\r\n"+path), response)
+	}
 }
@@ -21,6 +21,7 @@ func main() {
 	}
 
 	server := http.NewServer()
+	server.BufferPayload = true
 	server.AddHandler("POST", "/echo", func(w http.ResponseWriter, r *http.Request) {
 		if _, err := w.Write(r.Payload); err != nil {
 			logger.Errorw("error handling request", "error", err)
@@ -29,7 +30,7 @@ func main() {
 		logger.Debugw("Successfully written data")
 	})
 	server.AddHandler("GET", "/test", func(w http.ResponseWriter, r *http.Request) {
-		_ = w.SetStatus(200)
+		_ = w.SetStatus(http.StatusOK)
 	})
 
 	server.Run(ctx, listener)
@@ -2,12 +2,14 @@ module github.com/szykol/http
 
 go 1.22.5
 
-require go.uber.org/zap v1.27.0
+require (
+	go.uber.org/mock v0.4.0
+	go.uber.org/zap v1.27.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	go.uber.org/mock v0.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDrainBytes is how much of an unread request body the server is willing
+// to discard to keep the connection usable for the next request.
+const maxDrainBytes = 256 << 10
+
+var (
+	// ErrBodyTruncated is returned when the connection ends before the
+	// whole request body announced by the client was received.
+	ErrBodyTruncated = errors.New("request body truncated")
+
+	errBodyClosed = errors.New("read on closed body")
+)
+
+// body streams a request body straight from the connection. Once it is
+// fully read or closed the connection can move on to the next request.
+type body struct {
+	reader io.Reader
+	done   chan struct{}
+
+	closed     bool
+	incomplete bool
+
+	// awaitingContinue is set when the client sent "Expect: 100-continue"
+	// and waits for 100 Continue before sending the body. writeContinue
+	// sends it on the first read.
+	awaitingContinue bool
+	writeContinue    func() error
+}
+
+func newBody(reader io.Reader) *body {
+	return &body{
+		reader: reader,
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errBodyClosed
+	}
+
+	if err := b.requestContinue(); err != nil {
+		b.incomplete = true
+		b.finish()
+		return 0, err
+	}
+
+	n, err := b.reader.Read(p)
+	switch {
+	case errors.Is(err, io.EOF):
+		b.finish()
+	case err != nil:
+		// connection is out of sync with the message framing
+		b.incomplete = true
+		b.finish()
+	}
+
+	return n, err
+}
+
+// Close discards the rest of the body. If too much of it is left the
+// connection is marked as not reusable instead.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.isDone() {
+		return nil
+	}
+
+	if b.awaitingContinue {
+		// client may never send the body, there is nothing to drain
+		b.incomplete = true
+		b.finish()
+		return nil
+	}
+
+	n, err := io.CopyN(io.Discard, b.reader, maxDrainBytes+1)
+	if n > maxDrainBytes || !errors.Is(err, io.EOF) {
+		b.incomplete = true
+	}
+
+	b.finish()
+	return nil
+}
+
+// requestContinue asks the client waiting for 100 Continue to send the body.
+func (b *body) requestContinue() error {
+	if !b.awaitingContinue {
+		return nil
+	}
+	b.awaitingContinue = false
+
+	if b.writeContinue == nil {
+		return nil
+	}
+
+	if err := b.writeContinue(); err != nil {
+		return fmt.Errorf("error writing 100 Continue: %w", err)
+	}
+
+	return nil
+}
+
+// skipContinue is called once the final response is sent, the client can't
+// be asked for the body anymore. It reports whether the client still waits.
+func (b *body) skipContinue() bool {
+	b.writeContinue = nil
+	return b.awaitingContinue
+}
+
+func (b *body) finish() {
+	if !b.isDone() {
+		close(b.done)
+	}
+}
+
+func (b *body) isDone() bool {
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// lengthReader reads exactly n bytes of a body with known Content-Length,
+// no matter how many reads from the connection it takes.
+type lengthReader struct {
+	reader    *bufio.Reader
+	remaining int64
+}
+
+func (r *lengthReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	if errors.Is(err, io.EOF) && r.remaining > 0 {
+		return n, ErrBodyTruncated
+	}
+	if r.remaining == 0 && err == nil {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+type noBody struct{}
+
+func (noBody) Read([]byte) (int, error) { return 0, io.EOF }
+
+func (noBody) Close() error { return nil }
+
+// readPayload reads the whole request body, however many reads from the
+// connection it takes.
+func readPayload(request *Request) ([]byte, error) {
+	payload, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading payload: %w", err)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,158 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxChunkLineBytes bounds the chunk size line together with extensions.
+const maxChunkLineBytes = 4 << 10
+
+var errMalformedChunk = errors.New("malformed chunk")
+
+// chunkedReader decodes a body sent with "Transfer-Encoding: chunked".
+// Chunk extensions are ignored and trailer fields are added to trailers
+// once the last chunk is read.
+type chunkedReader struct {
+	reader *bufio.Reader
+	limits ParserLimits
+
+	remaining int64
+	needCRLF  bool
+	trailers  Header
+	err       error
+}
+
+func newChunkedReader(reader *bufio.Reader, limits ParserLimits) *chunkedReader {
+	return &chunkedReader{
+		reader:   reader,
+		limits:   limits,
+		trailers: make(Header),
+	}
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if r.remaining > 0 {
+			if len(p) == 0 {
+				return 0, nil
+			}
+
+			if int64(len(p)) > r.remaining {
+				p = p[:r.remaining]
+			}
+
+			n, err := r.reader.Read(p)
+			r.remaining -= int64(n)
+			r.err = truncated(err)
+
+			return n, r.err
+		}
+
+		r.err = r.nextChunk()
+	}
+
+	return 0, r.err
+}
+
+func (r *chunkedReader) nextChunk() error {
+	if r.needCRLF {
+		if err := r.readCRLF(); err != nil {
+			return err
+		}
+	}
+
+	line, err := readLine(r.reader, maxChunkLineBytes)
+	if err != nil {
+		return fmt.Errorf("error reading chunk size: %w", truncated(err))
+	}
+
+	size, err := parseChunkSize(line)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		trailers, err := readHeaders(r.reader, r.limits)
+		if err != nil {
+			return fmt.Errorf("error reading trailers: %w", truncated(err))
+		}
+
+		for key, values := range trailers {
+			if !trailerAllowed(key) {
+				continue
+			}
+
+			r.trailers[key] = append(r.trailers[key], values...)
+		}
+
+		return io.EOF
+	}
+
+	r.remaining = size
+	r.needCRLF = true
+
+	return nil
+}
+
+func (r *chunkedReader) readCRLF() error {
+	line, err := readLine(r.reader, maxChunkLineBytes)
+	if err != nil {
+		return fmt.Errorf("error reading chunk end: %w", truncated(err))
+	}
+
+	if string(line) != "\r\n" && string(line) != "\n" {
+		return fmt.Errorf("%w: missing CRLF after chunk data", errMalformedChunk)
+	}
+
+	r.needCRLF = false
+	return nil
+}
+
+func parseChunkSize(line []byte) (int64, error) {
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+
+	// drop chunk extensions
+	if i := bytes.IndexByte(line, ';'); i >= 0 {
+		line = bytes.TrimRight(line[:i], " \t")
+	}
+
+	if len(line) == 0 || bytes.IndexFunc(line, func(r rune) bool { return !isHexDigit(r) }) >= 0 {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", errMalformedChunk, line)
+	}
+
+	size, err := strconv.ParseInt(string(line), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", errMalformedChunk, line)
+	}
+
+	return size, nil
+}
+
+func isHexDigit(r rune) bool {
+	return '0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F'
+}
+
+// truncated reports connection EOF in the middle of a body as ErrBodyTruncated.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return ErrBodyTruncated
+	}
+
+	return err
+}
+
+// trailerAllowed reports whether a field can be sent in trailers. Fields
+// used for message framing or routing are only valid in headers.
+func trailerAllowed(key string) bool {
+	switch CanonicalHeaderKey(key) {
+	case "Content-Length", "Transfer-Encoding", "Trailer", "Host", "Connection", "Content-Type":
+		return false
+	default:
+		return true
+	}
+}
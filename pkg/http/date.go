@@ -0,0 +1,34 @@
+package http
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// dateCache keeps the Date header value formatted once per second, so it
+// doesn't have to be formatted for every response.
+type dateCache struct {
+	current atomic.Pointer[formattedDate]
+}
+
+type formattedDate struct {
+	unix  int64
+	value string
+}
+
+var responseDate dateCache
+
+func (c *dateCache) get(now time.Time) string {
+	unix := now.Unix()
+	if date := c.current.Load(); date != nil && date.unix == unix {
+		return date.value
+	}
+
+	date := &formattedDate{
+		unix:  unix,
+		value: now.UTC().Format(TimeFormat),
+	}
+	c.current.Store(date)
+
+	return date.value
+}
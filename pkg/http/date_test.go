@@ -0,0 +1,25 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateCache(t *testing.T) {
+	var c dateCache
+
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Thu, 01 Jan 2026 00:00:00 GMT", c.get(now))
+
+	// the value formatted at the beginning of the second is reused
+	cached := c.current.Load()
+	assert.Equal(t, "Thu, 01 Jan 2026 00:00:00 GMT", c.get(now.Add(999*time.Millisecond)))
+	assert.Same(t, cached, c.current.Load())
+
+	assert.Equal(t, "Thu, 01 Jan 2026 00:00:01 GMT", c.get(now.Add(time.Second)))
+
+	local := now.In(time.FixedZone("CET", 3600))
+	assert.Equal(t, "Thu, 01 Jan 2026 00:00:05 GMT", c.get(local.Add(5*time.Second)))
+}
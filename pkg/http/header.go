@@ -0,0 +1,100 @@
+package http
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Header holds header fields keyed by their canonical name, e.g.
+// "content-type" is stored as "Content-Type". Fields repeated in a message
+// keep all their values in order.
+type Header map[string][]string
+
+// Add appends value to the values of the key.
+func (h Header) Add(key, value string) {
+	key = CanonicalHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// Set replaces all values of the key with value.
+func (h Header) Set(key, value string) {
+	h[CanonicalHeaderKey(key)] = []string{value}
+}
+
+// Get returns the first value of the key or an empty string.
+func (h Header) Get(key string) string {
+	values := h[CanonicalHeaderKey(key)]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// Values returns all values of the key.
+func (h Header) Values(key string) []string {
+	return h[CanonicalHeaderKey(key)]
+}
+
+// Del removes all values of the key.
+func (h Header) Del(key string) {
+	delete(h, CanonicalHeaderKey(key))
+}
+
+func (h Header) has(key string) bool {
+	_, ok := h[CanonicalHeaderKey(key)]
+	return ok
+}
+
+// headerValueReplacer neutralises characters which would let a value end
+// the field and start a new field or the body, e.g. a redirect target taken
+// from the request.
+var headerValueReplacer = strings.NewReplacer("\r", " ", "\n", " ", "\x00", " ")
+
+// write writes header fields in wire format sorted by name, so responses
+// are deterministic. Fields with names which are not valid tokens are
+// skipped, line breaks in values are replaced with spaces.
+func (h Header) write(w io.Writer) error {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		if isToken(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, key := range keys {
+		for _, value := range h[key] {
+			builder.WriteString(key)
+			builder.WriteString(": ")
+			builder.WriteString(headerValueReplacer.Replace(value))
+			builder.WriteString("\r\n")
+		}
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// CanonicalHeaderKey returns the canonical form of a header name, with the
+// first letter and every letter following a hyphen upper case and the rest
+// lower case.
+func CanonicalHeaderKey(key string) string {
+	upper := true
+	canonical := []byte(key)
+
+	for i, c := range canonical {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			canonical[i] = c - ('a' - 'A')
+		case !upper && 'A' <= c && c <= 'Z':
+			canonical[i] = c + ('a' - 'A')
+		}
+
+		upper = c == '-'
+	}
+
+	return string(canonical)
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalHeaderKey(t *testing.T) {
+	testCases := map[string]string{
+		"content-type":    "Content-Type",
+		"CONTENT-LENGTH":  "Content-Length",
+		"x-forwarded-for": "X-Forwarded-For",
+		"Host":            "Host",
+		"etag":            "Etag",
+		"":                "",
+	}
+
+	for input, expected := range testCases {
+		assert.Equal(t, expected, CanonicalHeaderKey(input))
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := Header{}
+
+	h.Add("cookie", "a=1")
+	h.Add("COOKIE", "b=2")
+	assert.Equal(t, "a=1", h.Get("Cookie"))
+	assert.Equal(t, []string{"a=1", "b=2"}, h.Values("cookie"))
+
+	h.Set("Cookie", "c=3")
+	assert.Equal(t, []string{"c=3"}, h.Values("Cookie"))
+
+	h.Del("cookie")
+	assert.Equal(t, "", h.Get("Cookie"))
+	assert.Nil(t, h.Values("Cookie"))
+}
+
+func TestHeaderWrite(t *testing.T) {
+	h := Header{}
+	h.Set("Server", "unit-test")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Set("content-length", "0")
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, h.write(buf))
+
+	assert.Equal(t, "Content-Length: 0\r\nServer: unit-test\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n", buf.String())
+}
+
+func TestHeaderWriteInjection(t *testing.T) {
+	h := Header{}
+	h.Set("Location", "/home\r\nSet-Cookie: session=evil")
+	h.Set("X-Null", "a\x00b")
+	h["X-Bad\r\nSet-Cookie"] = []string{"session=evil"}
+	h["Bad Name"] = []string{"value"}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, h.write(buf))
+
+	assert.Equal(t, "Location: /home  Set-Cookie: session=evil\r\nX-Null: a b\r\n", buf.String())
+}
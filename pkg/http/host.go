@@ -0,0 +1,88 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// hostRouters holds routers registered for hosts. Exact hosts take
+// precedence over wildcard ones like "*.example.com", which are tried from
+// the most specific one.
+type hostRouters struct {
+	exact     map[string]*Router
+	wildcards []wildcardHost
+}
+
+type wildcardHost struct {
+	// suffix is the pattern without the leading "*", e.g. ".example.com"
+	suffix string
+	router *Router
+}
+
+// router returns the router of the host pattern, creating it on first use.
+func (h *hostRouters) router(pattern string) *Router {
+	host := hostName(pattern)
+
+	suffix, wildcard := strings.CutPrefix(host, "*")
+	if host == "" || strings.Contains(suffix, "*") || (wildcard && !strings.HasPrefix(suffix, ".")) {
+		panic(fmt.Sprintf("invalid host pattern %q", pattern))
+	}
+
+	if !wildcard {
+		if router, ok := h.exact[host]; ok {
+			return router
+		}
+
+		if h.exact == nil {
+			h.exact = make(map[string]*Router)
+		}
+
+		router := NewRouter()
+		h.exact[host] = router
+		return router
+	}
+
+	for _, w := range h.wildcards {
+		if w.suffix == suffix {
+			return w.router
+		}
+	}
+
+	router := NewRouter()
+	h.wildcards = append(h.wildcards, wildcardHost{suffix: suffix, router: router})
+	sort.SliceStable(h.wildcards, func(i, j int) bool {
+		return len(h.wildcards[i].suffix) > len(h.wildcards[j].suffix)
+	})
+
+	return router
+}
+
+// match returns the router registered for the host.
+func (h *hostRouters) match(host string) (*Router, bool) {
+	host = hostName(host)
+
+	if router, ok := h.exact[host]; ok {
+		return router, true
+	}
+
+	for _, w := range h.wildcards {
+		// wildcard matches subdomains only, not the domain itself
+		if len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return w.router, true
+		}
+	}
+
+	return nil, false
+}
+
+// hostName makes host names comparable. Port is dropped, names are case
+// insensitive and may be written with a trailing dot.
+func hostName(host string) string {
+	if withoutPort, _, err := net.SplitHostPort(host); err == nil {
+		host = withoutPort
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
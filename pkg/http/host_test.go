@@ -0,0 +1,53 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostRouters_Match(t *testing.T) {
+	var hosts hostRouters
+
+	api := hosts.router("api.example.com")
+	wildcard := hosts.router("*.example.com")
+	deepWildcard := hosts.router("*.eu.example.com")
+
+	assert.Same(t, api, hosts.router("API.example.com"), "Same pattern should return the same router")
+	assert.Same(t, wildcard, hosts.router("*.example.com"))
+
+	tests := []struct {
+		host     string
+		expected *Router
+	}{
+		{"api.example.com", api},
+		{"API.Example.COM", api},
+		{"api.example.com:8080", api},
+		{"api.example.com.", api},
+		{"www.example.com", wildcard},
+		{"a.b.example.com", wildcard},
+		{"shop.eu.example.com", deepWildcard},
+		{"eu.example.com", wildcard},
+		{"example.com", nil},
+		{"notexample.com", nil},
+		{"", nil},
+		{"[::1]:8080", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			router, ok := hosts.match(tt.host)
+
+			assert.Equal(t, tt.expected != nil, ok)
+			assert.Same(t, tt.expected, router)
+		})
+	}
+}
+
+func TestHostRouters_InvalidPatterns(t *testing.T) {
+	var hosts hostRouters
+
+	for _, pattern := range []string{"", "*", "*example.com", "api.*.com", "**.example.com"} {
+		assert.Panics(t, func() { hosts.router(pattern) }, "pattern %q", pattern)
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+var (
+	errRequestLineTooLong = errors.New("request line too long")
+	errHeadersTooLarge    = errors.New("request headers too large")
+	errBodyTooLarge       = errors.New("request body too large")
+
+	errLineTooLong = errors.New("line too long")
+)
+
+// ParserLimits bounds how much memory a single request can make the parser
+// allocate. Zero value of any field means no limit.
+type ParserLimits struct {
+	// MaxRequestLineBytes is the maximum length of the request line,
+	// longer ones are answered with 414 URI Too Long.
+	MaxRequestLineBytes int
+	// MaxHeaderBytes is the maximum size of all header lines together,
+	// larger header sections are answered with 431.
+	MaxHeaderBytes int
+	// MaxHeaders is the maximum number of header lines, more of them are
+	// answered with 431.
+	MaxHeaders int
+	// MaxBodyBytes is the maximum size of the request body, larger ones
+	// are answered with 413 Content Too Large.
+	MaxBodyBytes int64
+}
+
+// DefaultParserLimits are the limits used by NewServer.
+var DefaultParserLimits = ParserLimits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      1 << 20,
+	MaxHeaders:          100,
+	MaxBodyBytes:        10 << 20,
+}
+
+// readLine reads up to and including '\n', failing once the line gets
+// longer than limit instead of buffering it whole.
+func readLine(reader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if limit > 0 && len(line)+len(chunk) > limit {
+			return nil, errLineTooLong
+		}
+
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+}
+
+// maxBytesReader fails with errBodyTooLarge once more than the allowed
+// number of bytes is read from the underlying reader.
+type maxBytesReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.reader.Read(p)
+	if int64(n) > r.remaining {
+		r.remaining = 0
+		return n - 1, errBodyTooLarge
+	}
+
+	r.remaining -= int64(n)
+	return n, err
+}
@@ -6,85 +6,239 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"strconv"
 	"strings"
 )
 
+var (
+	errMalformedRequest            = errors.New("malformed request")
+	errUnsupportedProto            = errors.New("unsupported protocol version")
+	errTransferEncodingWithLength  = errors.New("both transfer-encoding and content-length present")
+	errUnsupportedTransferEncoding = errors.New("unsupported transfer-encoding")
+	errUnsupportedExpectation      = errors.New("unsupported expectation")
+)
+
 type Request struct {
 	Method        string
 	Proto         string
 	ContentLength int
 
-	Headers map[string]string
+	Headers Header
+
+	// Body streams the request body from the connection. It is always
+	// non-nil and closed by the server once the handler returns.
+	Body io.ReadCloser
+
+	// Payload holds the whole request body when Server.BufferPayload is set.
 	Payload []byte
 
-	path string
+	// Trailer holds trailer fields sent after a chunked body. It is nil
+	// for other requests and only filled once Body is read to the end.
+	Trailer Header
+
+	// URL is the parsed request target. Its Path is percent-decoded and
+	// used for routing, the query is available through URL.Query().
+	URL *url.URL
+
+	// Host is the host the request is addressed to, taken either from the
+	// request target or from the Host header.
+	Host string
+
+	body       *body
+	pathValues map[string]string
+}
+
+// PathValue returns the value of the named wildcard of the pattern matching
+// the request, or an empty string if there is no such wildcard.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
 }
 
 type startLine struct {
 	method string
-	path   string
+	target string
 	proto  string
 }
 
 func parseStartLine(line []byte) (startLine, error) {
 	var startLine startLine
-	splitted := bytes.Split(line, []byte(" "))
-	if len(splitted) < 3 {
-		return startLine, fmt.Errorf("invalid length of values in http start line")
+
+	line = bytes.TrimRight(line, "\r\n")
+	splitted := strings.Split(string(line), " ")
+	if len(splitted) != 3 {
+		return startLine, fmt.Errorf("%w: invalid length of values in http start line", errMalformedRequest)
+	}
+
+	startLine.method = splitted[0]
+	startLine.target = splitted[1]
+	startLine.proto = splitted[2]
+
+	if !isToken(startLine.method) {
+		return startLine, fmt.Errorf("%w: invalid method %q", errMalformedRequest, startLine.method)
+	}
+
+	if startLine.target == "" {
+		return startLine, fmt.Errorf("%w: empty request target", errMalformedRequest)
 	}
 
-	startLine.method = strings.TrimSpace(string(splitted[0]))
-	startLine.path = strings.TrimSpace(string(splitted[1]))
-	startLine.proto = strings.TrimSpace(string(splitted[2]))
+	if err := checkProto(startLine.proto); err != nil {
+		return startLine, err
+	}
 
 	return startLine, nil
 }
 
-func getContentLength(headers map[string]string) int {
-	length, ok := headers["content-length"]
-	if !ok {
-		return 0
+// checkProto accepts HTTP/1.x versions, other well formed versions are
+// reported as unsupported.
+func checkProto(proto string) error {
+	version, ok := strings.CutPrefix(proto, "HTTP/")
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+
+	if !ok || len(version) != 3 || !isDigit(version[0]) || version[1] != '.' || !isDigit(version[2]) {
+		return fmt.Errorf("%w: invalid protocol %q", errMalformedRequest, proto)
 	}
 
-	value, err := strconv.Atoi(length)
-	if err != nil {
-		return 0
+	if version[0] != '1' {
+		return fmt.Errorf("%w: %s", errUnsupportedProto, proto)
 	}
 
-	return value
+	return nil
 }
 
-func parseRequest(rd io.Reader) (Request, error) {
-	var parsedRequest Request
+// parseRequestTarget parses request target in any of the forms defined by
+// RFC 9112: origin-form ("/path?query"), absolute-form
+// ("http://host/path"), authority-form ("host:port", CONNECT only) and
+// asterisk-form ("*", OPTIONS only).
+func parseRequestTarget(method, target string) (*url.URL, error) {
+	switch {
+	case method == "CONNECT":
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return nil, fmt.Errorf("%w: invalid authority %q", errMalformedRequest, target)
+		}
 
-	reader := bufio.NewReader(rd)
+		return &url.URL{Host: target}, nil
+	case target == "*":
+		if method != "OPTIONS" {
+			return nil, fmt.Errorf("%w: asterisk-form is only allowed for OPTIONS", errMalformedRequest)
+		}
+
+		return &url.URL{Path: "*"}, nil
+	}
+
+	// fragments are not part of request target, drop it if client sent one
+	target, _, _ = strings.Cut(target, "#")
 
-	startLineStr, err := reader.ReadBytes('\n')
+	requestURL, err := url.ParseRequestURI(target)
 	if err != nil {
-		return parsedRequest, fmt.Errorf("error scanning startline: %w", err)
+		return nil, fmt.Errorf("%w: %w", errMalformedRequest, err)
 	}
 
-	startLine, err := parseStartLine(startLineStr)
+	if requestURL.IsAbs() {
+		if requestURL.Scheme != "http" && requestURL.Scheme != "https" {
+			return nil, fmt.Errorf("%w: unsupported scheme %q", errMalformedRequest, requestURL.Scheme)
+		}
+
+		if requestURL.Host == "" {
+			return nil, fmt.Errorf("%w: absolute-form without host", errMalformedRequest)
+		}
+
+		if requestURL.Path == "" {
+			requestURL.Path = "/"
+		}
+	}
+
+	return requestURL, nil
+}
+
+// isToken reports whether s is a non empty RFC 9110 token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range []byte(s) {
+		isAlnum := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getContentLength parses Content-Length of the message. Values other than
+// digits and differing repeated values are rejected, as the message framing
+// would be ambiguous.
+func getContentLength(headers Header) (int, error) {
+	length := ""
+
+	for _, value := range headers.Values("Content-Length") {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+
+			if v == "" || strings.Trim(v, "0123456789") != "" {
+				return 0, fmt.Errorf("%w: invalid content-length %q", errMalformedRequest, v)
+			}
+
+			if length != "" && v != length {
+				return 0, fmt.Errorf("%w: conflicting content-length values %q and %q", errMalformedRequest, length, v)
+			}
+			length = v
+		}
+	}
+
+	if length == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(length)
 	if err != nil {
-		return parsedRequest, fmt.Errorf("error parsing start line: %w", err)
+		return 0, fmt.Errorf("%w: invalid content-length %q", errMalformedRequest, length)
 	}
 
-	headers := make(map[string]string)
+	return value, nil
+}
+
+// readHeaders reads header fields up to and including the empty line
+// that terminates them.
+func readHeaders(reader *bufio.Reader, limits ParserLimits) (Header, error) {
+	headers := make(Header)
+	headerBytes := 0
+	headerCount := 0
 
 	for {
-		line, err := reader.ReadBytes('\n')
-		switch {
-		case errors.Is(err, io.EOF):
-			break
-		case err != nil:
-			return parsedRequest, fmt.Errorf("error parsing request: %w", err)
+		lineLimit := 0
+		if limits.MaxHeaderBytes > 0 {
+			// allow for terminating crlf on top of the header fields
+			lineLimit = limits.MaxHeaderBytes - headerBytes + len("\r\n")
+		}
+
+		line, err := readLine(reader, lineLimit)
+		if errors.Is(err, errLineTooLong) {
+			return headers, errHeadersTooLarge
+		}
+		if err != nil {
+			return headers, err
+		}
+		headerBytes += len(line)
+
+		// obsolete line folding continues the previous field, proxies
+		// ignoring it would see a different set of fields
+		if line[0] == ' ' || line[0] == '\t' {
+			return headers, fmt.Errorf("%w: obsolete line folding", errMalformedRequest)
 		}
 		line = bytes.TrimSpace(line)
 
 		if len(line) == 0 {
 			// stop on crlf
-			break
+			return headers, nil
+		}
+
+		headerCount++
+		if limits.MaxHeaders > 0 && headerCount > limits.MaxHeaders {
+			return headers, errHeadersTooLarge
 		}
 
 		splitted := bytes.SplitN(line, []byte(":"), 2)
@@ -94,30 +248,128 @@ func parseRequest(rd io.Reader) (Request, error) {
 			continue
 		}
 
-		key := string(bytes.ToLower(bytes.TrimSpace(splitted[0])))
-		value := string(bytes.ToLower(bytes.TrimSpace(splitted[1])))
+		// whitespace between field name and colon is not allowed, it could
+		// make proxies and the server disagree on the field
+		key := string(splitted[0])
+		if key == "" || bytes.ContainsAny(splitted[0], " \t") {
+			return headers, fmt.Errorf("%w: invalid header field name %q", errMalformedRequest, key)
+		}
+		value := string(bytes.TrimSpace(splitted[1]))
 
-		headers[key] = value
+		headers.Add(key, value)
 	}
+}
 
-	contentLength := getContentLength(headers)
-	var payload []byte
-	if contentLength > 0 {
-		buf := make([]byte, contentLength)
-		n, err := reader.Read(buf)
-		if err != nil {
-			return parsedRequest, fmt.Errorf("error parsing content: %w", err)
+// readBody prepares a lazy reader for the message body described by the
+// headers. It returns nil if the request has no body. Trailers are returned
+// for chunked bodies and filled once the body is read to the end.
+func readBody(reader *bufio.Reader, headers Header, limits ParserLimits) (*body, Header, error) {
+	if headers.has("Transfer-Encoding") {
+		// a message with both is a request smuggling attempt
+		if headers.has("Content-Length") {
+			return nil, nil, errTransferEncodingWithLength
+		}
+
+		transferEncoding := strings.Join(headers.Values("Transfer-Encoding"), ", ")
+		if !strings.EqualFold(transferEncoding, "chunked") {
+			return nil, nil, fmt.Errorf("%w: %s", errUnsupportedTransferEncoding, transferEncoding)
+		}
+
+		chunkedReader := newChunkedReader(reader, limits)
+
+		var chunked io.Reader = chunkedReader
+		if limits.MaxBodyBytes > 0 {
+			// size of chunked body is only known once it is read
+			chunked = &maxBytesReader{reader: chunked, remaining: limits.MaxBodyBytes}
 		}
 
-		payload = buf[:n]
+		return newBody(chunked), chunkedReader.trailers, nil
+	}
+
+	contentLength, err := getContentLength(headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentLength == 0 {
+		return nil, nil, nil
+	}
+
+	if limits.MaxBodyBytes > 0 && int64(contentLength) > limits.MaxBodyBytes {
+		return nil, nil, errBodyTooLarge
+	}
+
+	return newBody(&lengthReader{reader: reader, remaining: int64(contentLength)}), nil, nil
+}
+
+// parseRequest reads a single request head from the reader. The reader is
+// shared between requests on the same connection, so the body has to be
+// consumed through Request.Body before the next request can be parsed.
+func parseRequest(reader *bufio.Reader, limits ParserLimits) (Request, error) {
+	var parsedRequest Request
+
+	startLineStr, err := readLine(reader, limits.MaxRequestLineBytes)
+	if errors.Is(err, errLineTooLong) {
+		return parsedRequest, errRequestLineTooLong
+	}
+	if err != nil {
+		return parsedRequest, fmt.Errorf("error scanning startline: %w", err)
+	}
+
+	startLine, err := parseStartLine(startLineStr)
+	if err != nil {
+		return parsedRequest, fmt.Errorf("error parsing start line: %w", err)
+	}
+
+	requestURL, err := parseRequestTarget(startLine.method, startLine.target)
+	if err != nil {
+		return parsedRequest, fmt.Errorf("error parsing request target: %w", err)
+	}
+
+	headers, err := readHeaders(reader, limits)
+	if err != nil {
+		return parsedRequest, fmt.Errorf("error parsing request: %w", err)
+	}
+
+	// HTTP/1.1 requests need exactly one Host, a server can't tell which
+	// one of repeated ones the client meant
+	if hosts := len(headers.Values("Host")); hosts > 1 || (hosts == 0 && startLine.proto == "HTTP/1.1") {
+		return parsedRequest, fmt.Errorf("%w: request must contain exactly one Host header", errMalformedRequest)
+	}
+
+	body, trailer, err := readBody(reader, headers, limits)
+	if err != nil {
+		return parsedRequest, fmt.Errorf("error parsing content: %w", err)
+	}
+
+	// expectations are defined for HTTP/1.1 only
+	if expect := headers.Get("Expect"); expect != "" && startLine.proto == "HTTP/1.1" {
+		if !strings.EqualFold(expect, "100-continue") {
+			return parsedRequest, fmt.Errorf("%w: %s", errUnsupportedExpectation, expect)
+		}
+
+		if body != nil {
+			body.awaitingContinue = true
+		}
 	}
 
 	parsedRequest.Method = startLine.method
 	parsedRequest.Proto = startLine.proto
 	parsedRequest.Headers = headers
-	parsedRequest.Payload = payload
-	parsedRequest.ContentLength = contentLength
-	parsedRequest.path = startLine.path
+	parsedRequest.Body = noBody{}
+	if body != nil {
+		parsedRequest.Body = body
+		parsedRequest.body = body
+	}
+	parsedRequest.Trailer = trailer
+	// already validated by readBody
+	parsedRequest.ContentLength, _ = getContentLength(headers)
+	parsedRequest.URL = requestURL
+
+	// host from absolute-form and authority-form takes precedence
+	parsedRequest.Host = requestURL.Host
+	if parsedRequest.Host == "" {
+		parsedRequest.Host = headers.Get("Host")
+	}
 
 	return parsedRequest, nil
 }
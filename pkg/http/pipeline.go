@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bytes"
+	"io"
+)
+
+// maxPipelinedRequests limits how many requests from a single connection
+// can be handled concurrently.
+const maxPipelinedRequests = 16
+
+// maxPipelineBuffer limits output of a response buffered while previous
+// responses are written, writes exceeding it wait for their turn.
+const maxPipelineBuffer = 64 << 10
+
+// pipelinedWriter keeps responses of pipelined requests in request order.
+// Output is buffered until all previous responses on the connection are
+// written, after that it is passed straight to the connection.
+type pipelinedWriter struct {
+	writer io.Writer
+	prev   <-chan struct{}
+	done   chan struct{}
+
+	buffer    bytes.Buffer
+	closeConn bool
+}
+
+func newPipelinedWriter(w io.Writer, prev <-chan struct{}) *pipelinedWriter {
+	return &pipelinedWriter{
+		writer: w,
+		prev:   prev,
+		done:   make(chan struct{}),
+	}
+}
+
+func (w *pipelinedWriter) Write(message []byte) (int, error) {
+	if !w.isTurn() && w.buffer.Len()+len(message) <= maxPipelineBuffer {
+		return w.buffer.Write(message)
+	}
+
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+
+	return w.writer.Write(message)
+}
+
+// flush waits for the previous responses and writes the buffered output.
+func (w *pipelinedWriter) flush() error {
+	<-w.prev
+
+	return w.flushBuffer()
+}
+
+// finish waits for the previous response, writes whatever is still buffered
+// and lets the next response through. Connection of an aborted response is
+// closed, as responses following it could not be told apart, so is the
+// connection of a response sent with "Connection: close".
+func (w *pipelinedWriter) finish() error {
+	defer close(w.done)
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	if closer, ok := w.writer.(io.Closer); ok && w.closeConn {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// writeInterim writes an interim response once previous responses are
+// written, without buffering it. Client waits for it before sending the
+// rest of the request.
+func (w *pipelinedWriter) writeInterim(message []byte) error {
+	<-w.prev
+
+	_, err := w.Write(message)
+	return err
+}
+
+func (w *pipelinedWriter) abort() {
+	w.closeConn = true
+}
+
+// closeAfter closes the connection once the response is written.
+func (w *pipelinedWriter) closeAfter() {
+	w.closeConn = true
+}
+
+func (w *pipelinedWriter) isTurn() bool {
+	select {
+	case <-w.prev:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *pipelinedWriter) flushBuffer() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+
+	_, err := w.buffer.WriteTo(w.writer)
+	return err
+}
+
+func closedChan() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelinedWriterOrder(t *testing.T) {
+	conn := &bytes.Buffer{}
+
+	first := newPipelinedWriter(conn, closedChan())
+	second := newPipelinedWriter(conn, first.done)
+
+	_, _ = second.Write([]byte("second"))
+	_, _ = first.Write([]byte("first "))
+
+	assert.Equal(t, "first ", conn.String())
+
+	assert.Nil(t, first.finish())
+	_, _ = second.Write([]byte(" response"))
+	assert.Nil(t, second.finish())
+
+	assert.Equal(t, "first second response", conn.String())
+}
+
+func TestPipelinedWriterBufferLimit(t *testing.T) {
+	conn := &bytes.Buffer{}
+	prev := make(chan struct{})
+	w := newPipelinedWriter(conn, prev)
+
+	_, _ = w.Write(bytes.Repeat([]byte("a"), maxPipelineBuffer))
+	assert.Equal(t, maxPipelineBuffer, w.buffer.Len())
+
+	written := make(chan struct{})
+	go func() {
+		_, _ = w.Write([]byte("b"))
+		close(written)
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("write exceeding the buffer did not wait for previous response")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	close(prev)
+	<-written
+
+	assert.Equal(t, maxPipelineBuffer+1, conn.Len())
+	assert.Equal(t, 0, w.buffer.Len())
+}
+
+func TestPipelinedWriterFlush(t *testing.T) {
+	conn := &bytes.Buffer{}
+	prev := make(chan struct{})
+	w := newPipelinedWriter(conn, prev)
+
+	response, _ := setupResponseTest(t)
+	response.writer = w
+	response.canChunk = true
+	_, _ = response.Write([]byte("streamed"))
+
+	flushed := make(chan error)
+	go func() {
+		flushed <- response.Flush()
+	}()
+
+	select {
+	case <-flushed:
+		t.Fatal("flush did not wait for previous response")
+	case <-time.After(5 * time.Millisecond):
+	}
+	assert.Equal(t, 0, conn.Len())
+
+	close(prev)
+	assert.Nil(t, <-flushed)
+	assert.Contains(t, conn.String(), "8\r\nstreamed\r\n")
+}
@@ -1,16 +1,55 @@
 package http
 
+import "fmt"
+
+// Handler responds to a request. Handlers keeping state can be registered
+// with Handle, functions with AddHandler.
+type Handler interface {
+	ServeHTTP(ResponseWriter, *Request)
+}
+
 type RequestHandler func(ResponseWriter, *Request)
 
-type handlerIdentifier struct {
-	path   string
-	method string
+// ServeHTTP calls h(w, r).
+func (h RequestHandler) ServeHTTP(w ResponseWriter, r *Request) {
+	h(w, r)
+}
+
+// Middleware wraps a handler with logic running before or after it.
+type Middleware func(RequestHandler) RequestHandler
+
+// ErrorHandler responds to a request the server failed to read. err is the
+// reason of the failure and statusCode the status the server suggests.
+type ErrorHandler func(w ResponseWriter, statusCode int, err error)
+
+// chain wraps the handler with middleware, the first one is the outermost.
+func chain(handler RequestHandler, middleware []Middleware) RequestHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+func BadRequestHandler(w ResponseWriter, r *Request) {
+	_ = w.SetStatus(StatusBadRequest)
 }
 
 func NotFoundHandler(w ResponseWriter, r *Request) {
-	_ = w.SetStatus(404)
+	_ = w.SetStatus(StatusNotFound)
+}
+
+func MethodNotAllowedHandler(w ResponseWriter, r *Request) {
+	_ = w.SetStatus(StatusMethodNotAllowed)
 }
 
 func InternalServerErrorHandler(w ResponseWriter, r *Request) {
-	_ = w.SetStatus(500)
+	_ = w.SetStatus(StatusInternalServerError)
+}
+
+// DefaultErrorHandler responds with the status code and its description as
+// a body, details of the error are not disclosed to the client.
+func DefaultErrorHandler(w ResponseWriter, statusCode int, err error) {
+	_ = w.SetStatus(statusCode)
+	_, _ = fmt.Fprintf(w, "%d %s", statusCode, StatusText(statusCode))
 }
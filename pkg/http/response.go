@@ -2,116 +2,457 @@ package http
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"go.uber.org/zap/buffer"
+	"github.com/szykol/http/pkg/log"
+	"go.uber.org/zap"
 )
 
+// ErrBodyNotAllowed is returned by Write when the response status does not
+// permit a body, e.g. 204 No Content.
+var ErrBodyNotAllowed = errors.New("response status does not allow body")
+
+// TimeFormat is the format of dates in HTTP headers, e.g. the Date header.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
 type ResponseWriter interface {
+	// Write appends data to the response body. Status 200 is used if
+	// SetStatus was not called before. Body of a response to HEAD request
+	// is discarded, it is only counted for Content-Length.
 	io.Writer
 
+	// Header returns headers sent with the response. Changes made after
+	// the response is sent have no effect.
+	Header() Header
+
+	// Trailer returns trailer fields sent after the body. Fields have to
+	// be declared before the response is sent, either by adding them to
+	// Trailer or by listing them in the "Trailer" header, their values can
+	// be set until the handler returns. Trailers force chunked transfer
+	// coding and are dropped for clients not supporting it.
+	Trailer() Header
+
+	// SetStatus sets the status code of the response. Only the first call
+	// has an effect, following ones are logged and ignored.
+	//
+	// Informational 1xx statuses are sent right away together with headers
+	// set so far, e.g. 103 Early Hints, and can be sent multiple times
+	// before the final status. HTTP/1.0 clients don't get them. 100 Continue
+	// is sent on the first read of the request body when the client asks for
+	// it, a handler can reject such request without reading the body.
 	SetStatus(int) error
 }
 
+// responseBufferSize is how much of the body is buffered before the
+// response is sent with chunked transfer coding instead of Content-Length.
+const responseBufferSize = 4 << 10
+
+// Flusher is implemented by ResponseWriters which can send buffered data
+// to the client before the handler returns.
+type Flusher interface {
+	// Flush sends headers and the body written so far. Response to
+	// a pipelined request waits until previous responses are sent.
+	Flush() error
+}
+
+// responseWriter goes through status, headers and body phases. Status and
+// headers can be changed until the response is sent. Small bodies are
+// collected so the response can be framed with Content-Length once the
+// handler returns, bigger ones and flushed ones are streamed in chunks.
 type responseWriter struct {
 	writer     io.Writer
-	headers    map[string]string
+	logger     *zap.SugaredLogger
+	headers    Header
+	trailers   Header
 	statusCode int
+	keepAlive  bool
+	canChunk   bool
+	serverName string
 
-	buffer *bytes.Buffer
+	// discardBody is set for HEAD requests, the body is only counted and
+	// its beginning kept to detect Content-Type
+	discardBody bool
+	discarded   int
+
+	// requestBody is the body of the request being answered, if any
+	requestBody *body
+	wroteHeader bool
+	chunked     bool
+	aborted     bool
+	body        bytes.Buffer
 }
 
-func newResponseWriter(w io.Writer) *responseWriter {
+func newResponseWriter(ctx context.Context, w io.Writer) *responseWriter {
 	return &responseWriter{
-		writer:  w,
-		headers: make(map[string]string),
-		buffer:  &bytes.Buffer{},
+		writer:     w,
+		logger:     log.FromContext(ctx),
+		headers:    make(Header),
+		trailers:   make(Header),
+		serverName: defaultServerName,
 	}
 }
 
 func (w *responseWriter) Write(message []byte) (int, error) {
 	if w.statusCode == 0 {
-		if err := w.SetStatus(200); err != nil {
-			return 0, fmt.Errorf("could not set status: %w", err)
+		w.statusCode = StatusOK
+	}
+
+	if !bodyAllowed(w.statusCode) {
+		return 0, ErrBodyNotAllowed
+	}
+
+	if w.discardBody {
+		w.discarded += len(message)
+		if room := sniffLen - w.body.Len(); room > 0 {
+			_, _ = w.body.Write(message[:min(room, len(message))])
 		}
+
+		return len(message), nil
 	}
 
-	contentLength := len(message)
+	n, _ := w.body.Write(message)
+	if w.body.Len() > responseBufferSize {
+		if err := w.flushBody(); err != nil {
+			return n, err
+		}
+	}
 
-	w.setContentLength(contentLength)
-	w.setContentType("application/x-www-form-urlencoded")
-	w.setHeader("Connection", "Keep-Alive")
-	w.setHeader("Server", "go-simple-server")
-	w.write([]byte("\r\n"))
-	w.write(message)
+	return n, nil
+}
 
-	return w.writer.Write(w.buffer.Bytes())
+func (w *responseWriter) Header() Header {
+	return w.headers
 }
 
-func (w *responseWriter) setHeader(key string, value string) {
+func (w *responseWriter) Trailer() Header {
+	return w.trailers
+}
+
+func (w *responseWriter) SetStatus(statusCode int) error {
+	if err := checkStatusCode(statusCode); err != nil {
+		return err
+	}
+
+	if statusCode < StatusOK {
+		return w.writeInformational(statusCode)
+	}
+
+	if w.statusCode != 0 {
+		w.logger.Warnw("Superfluous SetStatus call", "statusCode", statusCode, "currentStatusCode", w.statusCode)
+		return nil
+	}
+
+	w.statusCode = statusCode
+	return nil
+}
+
+// Flush sends headers followed by the buffered body. Unless the handler
+// set Content-Length the body is sent with chunked transfer coding. Clients
+// not supporting it get the whole response once the handler returns.
+// Response to a pipelined request waits until previous responses on the
+// connection are sent.
+func (w *responseWriter) Flush() error {
+	if err := w.flushBody(); err != nil {
+		return err
+	}
+
+	if f, ok := w.writer.(interface{ flush() error }); ok && w.wroteHeader {
+		return f.flush()
+	}
+
+	return nil
+}
+
+// flushBody passes headers and the buffered body to the writer.
+func (w *responseWriter) flushBody() error {
+	if !w.wroteHeader {
+		if !w.canChunk && !w.headers.has("Content-Length") {
+			return nil
+		}
+
+		if w.statusCode == 0 {
+			w.statusCode = StatusOK
+		}
+
+		if bodyAllowed(w.statusCode) {
+			if w.body.Len() > 0 {
+				w.setDefaultHeader("Content-Type", detectContentType(w.body.Bytes()))
+			}
+
+			if !w.headers.has("Content-Length") {
+				w.chunked = true
+				w.setHeader("Transfer-Encoding", "chunked")
+				w.declareTrailers()
+			}
+		}
+
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if w.body.Len() == 0 || w.discardBody {
+		w.body.Reset()
+		return nil
+	}
+
+	_, err := w.writeBody(w.body.Bytes())
+	w.body.Reset()
+
+	return err
+}
+
+// finish sends the response once the handler is done with it. A handler
+// which neither wrote nor set status produces an empty 200 response.
+func (w *responseWriter) finish() error {
+	if w.aborted {
+		return nil
+	}
+
+	if w.wroteHeader {
+		return w.finishStream()
+	}
+
+	if w.statusCode == 0 {
+		w.statusCode = StatusOK
+	}
+
+	// trailers can only be sent after a chunked body
+	if w.hasTrailers() && w.canChunk && bodyAllowed(w.statusCode) && !w.headers.has("Content-Length") {
+		return w.finishStream()
+	}
+
+	if bodyAllowed(w.statusCode) {
+		w.setDefaultHeader("Content-Length", strconv.Itoa(w.bodyLength()))
+		if w.body.Len() > 0 {
+			w.setDefaultHeader("Content-Type", detectContentType(w.body.Bytes()))
+		}
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	if w.discardBody {
+		return nil
+	}
+
+	_, err := w.body.WriteTo(w.writer)
+	return err
+}
+
+func (w *responseWriter) bodyLength() int {
+	if w.discardBody {
+		return w.discarded
+	}
+
+	return w.body.Len()
+}
+
+func (w *responseWriter) finishStream() error {
+	if err := w.flushBody(); err != nil {
+		return err
+	}
+
+	if !w.chunked || w.discardBody {
+		return nil
+	}
+
 	buf := bytes.Buffer{}
-	_, _ = buf.WriteString(key)
-	_, _ = buf.Write([]byte(": "))
-	_, _ = buf.WriteString(value)
-	_, _ = buf.Write([]byte("\r\n"))
+	_, _ = buf.WriteString("0\r\n")
+	_ = w.trailerFields().write(&buf)
+	_, _ = buf.WriteString("\r\n")
+
+	_, err := buf.WriteTo(w.writer)
+	return err
+}
 
-	w.write(buf.Bytes())
+func (w *responseWriter) hasTrailers() bool {
+	return len(w.trailers) > 0 || w.headers.has("Trailer")
 }
 
-func (w *responseWriter) setContentType(contentType string) {
-	w.setHeader("Content-Type", contentType)
+// declareTrailers lists trailer fields set so far in the "Trailer" header,
+// unless the handler declared them on its own.
+func (w *responseWriter) declareTrailers() {
+	if w.headers.has("Trailer") || len(w.trailers) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(w.trailers))
+	for key := range w.trailers {
+		if trailerAllowed(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		w.setHeader("Trailer", strings.Join(keys, ", "))
+	}
 }
 
-func (w *responseWriter) setContentLength(length int) {
-	w.setHeader("Content-Length", strconv.Itoa(length))
+// trailerFields returns trailers with values, skipping fields which are not
+// allowed in trailers.
+func (w *responseWriter) trailerFields() Header {
+	fields := make(Header)
+
+	for key, values := range w.trailers {
+		if !trailerAllowed(key) {
+			w.logger.Warnw("Dropping field not allowed in trailers", "field", key)
+			continue
+		}
+
+		for _, value := range values {
+			if value != "" {
+				fields.Add(key, value)
+			}
+		}
+	}
+
+	return fields
 }
 
-func (w *responseWriter) write(message []byte) {
-	_, _ = w.buffer.Write(message)
+// reset drops everything the handler set so far, as long as nothing was
+// sent yet.
+func (w *responseWriter) reset() bool {
+	if w.wroteHeader {
+		return false
+	}
+
+	w.statusCode = 0
+	w.headers = make(Header)
+	w.trailers = make(Header)
+	w.body.Reset()
+	w.discarded = 0
+
+	return true
 }
 
-func (w *responseWriter) SetStatus(statusCode int) error {
-	w.statusCode = statusCode
+// abort gives up on a response which is already partially sent. The
+// connection can't be reused, as the client can't tell where it ends.
+func (w *responseWriter) abort() {
+	w.aborted = true
 
-	buf := buffer.Buffer{}
-	_, _ = buf.Write([]byte("HTTP/1.1 "))
+	if a, ok := w.writer.(interface{ abort() }); ok {
+		a.abort()
+	}
+}
 
+func (w *responseWriter) writeBody(message []byte) (int, error) {
+	if !w.chunked {
+		return w.writer.Write(message)
+	}
+
+	// empty chunk would mark the end of the body
+	if len(message) == 0 {
+		return 0, nil
+	}
+
+	buf := bytes.Buffer{}
+	_, _ = buf.WriteString(strconv.FormatInt(int64(len(message)), 16))
+	_, _ = buf.WriteString("\r\n")
+	_, _ = buf.Write(message)
+	_, _ = buf.WriteString("\r\n")
+
+	if _, err := buf.WriteTo(w.writer); err != nil {
+		return 0, err
+	}
+
+	return len(message), nil
+}
+
+// writeInformational sends an interim 1xx response with headers set so far.
+func (w *responseWriter) writeInformational(statusCode int) error {
+	switch {
+	case w.wroteHeader:
+		return fmt.Errorf("informational status %d after final response", statusCode)
+	case statusCode == StatusSwitchingProtocols:
+		return errors.New("switching protocols is not supported")
+	case !w.canChunk:
+		// interim responses are not understood before HTTP/1.1
+		return nil
+	case statusCode == StatusContinue:
+		if w.requestBody == nil {
+			return nil
+		}
+
+		return w.requestBody.requestContinue()
+	}
+
+	return w.writeHead(statusCode)
+}
+
+func (w *responseWriter) writeHeader() error {
+	w.wroteHeader = true
+
+	// body of a client still waiting for 100 Continue may never come, so
+	// the connection can't be reused
+	if w.requestBody != nil && w.requestBody.skipContinue() {
+		w.keepAlive = false
+	}
+
+	// headers set by the handler take precedence over the defaults
+	if w.serverName != "" {
+		w.setDefaultHeader("Server", w.serverName)
+	}
+	w.setDefaultHeader("Date", responseDate.get(time.Now()))
+	if hasToken(w.headers.Get("Connection"), "close") {
+		w.keepAlive = false
+	}
+	if w.keepAlive {
+		w.setDefaultHeader("Connection", "Keep-Alive")
+	} else {
+		// handler can't keep alive a connection the server has to close
+		w.setHeader("Connection", "close")
+
+		if c, ok := w.writer.(interface{ closeAfter() }); ok {
+			c.closeAfter()
+		}
+	}
+
+	return w.writeHead(w.statusCode)
+}
+
+// writeHead sends the status line and headers.
+func (w *responseWriter) writeHead(statusCode int) error {
+	buf := bytes.Buffer{}
+	_, _ = buf.WriteString("HTTP/1.1 ")
 	_, _ = buf.WriteString(strconv.Itoa(statusCode))
 	_ = buf.WriteByte(' ')
-	_, _ = buf.WriteString(getStatus(statusCode))
-	_, _ = buf.Write([]byte("\r\n"))
+	_, _ = buf.WriteString(StatusText(statusCode))
+	_, _ = buf.WriteString("\r\n")
+	_ = w.headers.write(&buf)
+	_, _ = buf.WriteString("\r\n")
 
-	_, err := w.writer.Write(buf.Bytes())
+	_, err := buf.WriteTo(w.writer)
 	return err
 }
 
-func getStatus(statusCode int) string {
-	switch statusCode {
-	case 200:
-		return "OK"
-	case 201:
-		return "Created"
-	case 202:
-		return "Accepted"
-	case 204:
-		return "No Content"
-	case 400:
-		return "Bad Request"
-	case 401:
-		return "Unauthorized"
-	case 403:
-		return "Forbidden"
-	case 404:
-		return "Not Found"
-	case 409:
-		return "Conflict"
-	case 418:
-		return "I'm a teapot"
-	case 500:
-		return "Internal Server Error"
+func (w *responseWriter) setHeader(key string, value string) {
+	w.headers.Set(key, value)
+}
+
+func (w *responseWriter) setDefaultHeader(key string, value string) {
+	if !w.headers.has(key) {
+		w.headers.Set(key, value)
+	}
+}
+
+// bodyAllowed reports whether a response with the status can have a body.
+func bodyAllowed(statusCode int) bool {
+	switch {
+	case statusCode >= StatusContinue && statusCode < StatusOK:
+		return false
+	case statusCode == StatusNoContent, statusCode == StatusNotModified:
+		return false
 	default:
-		return "UNKNOWN"
+		return true
 	}
 }
@@ -0,0 +1,294 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szykol/http/pkg/log"
+)
+
+func setupResponseTest(t *testing.T) (*responseWriter, *bytes.Buffer) {
+	ctx := log.WithContext(context.Background(), log.NewLogger(log.NewZapCfg()))
+	rd := &bytes.Buffer{}
+
+	w := newResponseWriter(ctx, rd)
+	w.keepAlive = true
+
+	return w, rd
+}
+
+func TestResponseWriter_MultipleWrites(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	_, _ = w.Write([]byte("unit "))
+	_, _ = w.Write([]byte("test"))
+	assert.Empty(t, rd.String(), "Response should not be sent before handler returns")
+
+	assert.Nil(t, w.finish())
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 9\r\nContent-Type: text/plain; charset=utf-8\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\n\r\nunit test"
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestResponseWriter_StatusOnly(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	assert.Nil(t, w.SetStatus(404))
+	assert.Nil(t, w.finish())
+
+	expectedResponse := "HTTP/1.1 404 Not Found\r\nConnection: Keep-Alive\r\nContent-Length: 0\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\n\r\n"
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestResponseWriter_NothingWritten(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, rd.String(), "Content-Length: 0\r\n")
+}
+
+func TestResponseWriter_DuplicateSetStatus(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	assert.Nil(t, w.SetStatus(201))
+	assert.Nil(t, w.SetStatus(500))
+	_, _ = w.Write([]byte("created"))
+	assert.Nil(t, w.SetStatus(400))
+	assert.Nil(t, w.finish())
+
+	assert.Equal(t, 1, bytes.Count(rd.Bytes(), []byte("HTTP/1.1")))
+	assert.Contains(t, rd.String(), "HTTP/1.1 201 Created\r\n")
+}
+
+func TestResponseWriter_NoContent(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	assert.Nil(t, w.SetStatus(204))
+	_, err := w.Write([]byte("body"))
+	assert.ErrorIs(t, err, ErrBodyNotAllowed)
+	assert.Nil(t, w.finish())
+
+	assert.NotContains(t, rd.String(), "Content-Length")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n")))
+}
+
+func TestResponseWriter_Reset(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	w.Header().Set("X-Partial", "1")
+	_, _ = w.Write([]byte("partial"))
+
+	assert.True(t, w.reset())
+	assert.Nil(t, w.SetStatus(500))
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 500 Internal Server Error\r\n")
+	assert.NotContains(t, rd.String(), "partial")
+	assert.NotContains(t, rd.String(), "X-Partial")
+
+	assert.False(t, w.reset(), "Sent response cannot be reset")
+}
+
+func TestResponseWriter_ChunkedAboveThreshold(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	message := bytes.Repeat([]byte("a"), responseBufferSize)
+	_, _ = w.Write(message)
+	assert.Empty(t, rd.String(), "Response within buffer size should not be sent yet")
+
+	_, _ = w.Write([]byte("bc"))
+	assert.Contains(t, rd.String(), "Transfer-Encoding: chunked\r\n")
+	assert.NotContains(t, rd.String(), "Content-Length")
+
+	_, _ = w.Write([]byte("def"))
+	assert.Nil(t, w.finish())
+
+	expectedBody := "1002\r\n" + string(message) + "bc\r\n3\r\ndef\r\n0\r\n\r\n"
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n"+expectedBody)))
+}
+
+func TestResponseWriter_Flush(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	var flusher Flusher = w
+
+	_, _ = w.Write([]byte("first"))
+	assert.Nil(t, flusher.Flush())
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 200 OK\r\n")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n5\r\nfirst\r\n")))
+
+	w.Header().Set("X-Too-Late", "1")
+	_, _ = w.Write([]byte("second"))
+	assert.Nil(t, flusher.Flush())
+	assert.Nil(t, w.finish())
+
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("5\r\nfirst\r\n6\r\nsecond\r\n0\r\n\r\n")))
+	assert.NotContains(t, rd.String(), "X-Too-Late")
+}
+
+func TestResponseWriter_FlushWithContentLength(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	w.Header().Set("Content-Length", "11")
+	_, _ = w.Write([]byte("first "))
+	assert.Nil(t, w.Flush())
+	_, _ = w.Write([]byte("second"))
+	assert.Nil(t, w.finish())
+
+	assert.NotContains(t, rd.String(), "Transfer-Encoding")
+	assert.Contains(t, rd.String(), "Content-Length: 11\r\n")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\nfirst second")))
+}
+
+func TestResponseWriter_NoChunkingForHTTP10(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = false
+
+	message := bytes.Repeat([]byte("a"), responseBufferSize*2)
+	_, _ = w.Write(message)
+	assert.Nil(t, w.Flush())
+	assert.Empty(t, rd.String(), "Response should be buffered for clients without chunked support")
+
+	assert.Nil(t, w.finish())
+	assert.Contains(t, rd.String(), "Content-Length: 8192\r\n")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), message))
+}
+
+func TestResponseWriter_DiscardBody(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+	w.discardBody = true
+
+	message := bytes.Repeat([]byte("a"), responseBufferSize*2)
+	n, err := w.Write(message)
+	assert.Nil(t, err)
+	assert.Equal(t, len(message), n)
+	assert.Empty(t, rd.String(), "Discarded body should not trigger streaming")
+
+	assert.Nil(t, w.finish())
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 8192\r\nContent-Type: text/plain; charset=utf-8\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\n\r\n"
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestResponseWriter_DiscardBodyFlushed(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+	w.discardBody = true
+
+	_, _ = w.Write([]byte("first"))
+	assert.Nil(t, w.Flush())
+	_, _ = w.Write([]byte("second"))
+	assert.Nil(t, w.finish())
+
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("Transfer-Encoding: chunked\r\n\r\n")), "Only headers should be sent")
+}
+
+func TestResponseWriter_Trailers(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	w.Trailer().Set("X-Checksum", "")
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("unit test"))
+	w.Trailer().Set("X-Checksum", "abc123")
+	w.Trailer().Set("Content-Length", "9")
+	assert.Nil(t, w.finish())
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Type: text/plain\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\nTrailer: X-Checksum\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"9\r\nunit test\r\n0\r\nX-Checksum: abc123\r\n\r\n"
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestResponseWriter_TrailersDeclaredInHeader(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	_, _ = w.Write([]byte("unit test"))
+	assert.Nil(t, w.Flush())
+
+	w.Trailer().Set("Grpc-Status", "0")
+	w.Trailer().Set("Grpc-Message", "OK")
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "Trailer: Grpc-Status, Grpc-Message\r\n")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("0\r\nGrpc-Message: OK\r\nGrpc-Status: 0\r\n\r\n")))
+}
+
+func TestResponseWriter_TrailersInjection(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	w.Header().Set("Trailer", "X-Checksum")
+	_, _ = w.Write([]byte("unit test"))
+	w.Trailer().Set("X-Checksum", "abc\r\n\r\nHTTP/1.1 200 OK")
+	assert.Nil(t, w.finish())
+
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("0\r\nX-Checksum: abc    HTTP/1.1 200 OK\r\n\r\n")))
+}
+
+func TestResponseWriter_TrailersWithoutChunking(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = false
+
+	w.Trailer().Set("X-Checksum", "abc123")
+	_, _ = w.Write([]byte("unit test"))
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "Content-Length: 9\r\n")
+	assert.NotContains(t, rd.String(), "X-Checksum")
+}
+
+func TestResponseWriter_Informational(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = true
+
+	w.Header().Add("Link", "</style.css>; rel=preload; as=style")
+	assert.Nil(t, w.SetStatus(StatusEarlyHints))
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n\r\n", rd.String())
+
+	_, _ = w.Write([]byte("ok"))
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "\r\n\r\nHTTP/1.1 200 OK\r\n")
+	assert.Error(t, w.SetStatus(StatusEarlyHints), "Informational status should not follow final response")
+}
+
+func TestResponseWriter_InformationalHTTP10(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.canChunk = false
+
+	assert.Nil(t, w.SetStatus(StatusEarlyHints))
+	assert.Empty(t, rd.String())
+	assert.Error(t, w.SetStatus(StatusSwitchingProtocols))
+}
+
+func TestResponseWriter_HandlerClosesConnection(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	w.Header().Set("Connection", "close")
+	assert.Nil(t, w.finish())
+
+	assert.False(t, w.keepAlive)
+	assert.Contains(t, rd.String(), "Connection: close\r\n")
+	assert.NotContains(t, rd.String(), "Keep-Alive")
+}
+
+func TestResponseWriter_HandlerCantKeepAlive(t *testing.T) {
+	w, rd := setupResponseTest(t)
+	w.keepAlive = false
+
+	w.Header().Set("Connection", "Keep-Alive")
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "Connection: close\r\n")
+}
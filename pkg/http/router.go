@@ -0,0 +1,457 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Router registers handlers for paths under a common prefix, wrapped with
+// its own middleware. Routers returned by Group share the handlers with
+// the router they were created from, ones created with NewRouter have
+// their own and can be mounted under a prefix with Mount.
+type Router struct {
+	routes     *routeNode
+	prefix     string
+	parent     *Router
+	middleware []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{routes: &routeNode{}}
+}
+
+// AddHandler registers the handler for the method and path pattern, the
+// prefix of the router is added to the pattern. Pattern segments written as
+// "{name}" match any single path segment and a final "{name...}" segment
+// matches the rest of the path, matched values are available decoded through
+// Request.PathValue. It panics if a handler for the method and pattern is
+// already registered.
+//
+// Middleware given here wraps only this handler, inside of the middleware
+// added with Use.
+func (r *Router) AddHandler(method, path string, requestHandler RequestHandler, middleware ...Middleware) {
+	r.routes.add(method, r.prefix+path, r.withGroupMiddleware(chain(requestHandler, middleware)))
+}
+
+// Use adds middleware wrapping requests handled by the router. Middleware
+// runs in the order it is added, the first one is the outermost, and wraps
+// middleware of groups created from the router.
+//
+// Middleware of a router dispatching requests on its own, created with
+// NewRouter, wraps also requests answered with 404 or 405. Middleware of a
+// group wraps only handlers registered with the group.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Group returns a router registering handlers under the prefix, e.g. a
+// group with "/api/v1" prefix registers "/users" as "/api/v1/users".
+func (r *Router) Group(prefix string) *Router {
+	return &Router{
+		routes: r.routes,
+		prefix: r.prefix + prefix,
+		parent: r,
+	}
+}
+
+// Handle registers the handler for the method and path pattern, the same
+// way as AddHandler.
+func (r *Router) Handle(method, path string, handler Handler, middleware ...Middleware) {
+	r.AddHandler(method, path, handler.ServeHTTP, middleware...)
+}
+
+// Mount passes requests for the prefix and paths under it to the handler,
+// with the prefix stripped from Request.URL. E.g. a router mounted under
+// "/admin" gets request for "/admin/users" as "/users". Any Handler can be
+// mounted, including other routers and servers. Handlers registered
+// directly for paths under the prefix take precedence. It panics if
+// a handler is already mounted under the prefix.
+func (r *Router) Mount(prefix string, handler Handler) {
+	prefix = strings.TrimSuffix(r.prefix+prefix, "/")
+
+	escapedPrefix := (&url.URL{Path: prefix}).EscapedPath()
+
+	r.routes.mount(prefix, r.withGroupMiddleware(func(w ResponseWriter, req *Request) {
+		stripped := *req
+		strippedURL := *req.URL
+		strippedURL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+		// keep escapes like %2F, unless the prefix itself was escaped differently
+		rawPath, ok := strings.CutPrefix(req.URL.RawPath, escapedPrefix)
+		if !ok {
+			rawPath = ""
+		}
+		strippedURL.RawPath = rawPath
+		if strippedURL.Path == "" {
+			strippedURL.Path = "/"
+			strippedURL.RawPath = ""
+		}
+		stripped.URL = &strippedURL
+
+		handler.ServeHTTP(w, &stripped)
+	}))
+}
+
+// ServeHTTP dispatches the request to the handler registered for its path.
+// "OPTIONS *" requests asking about the server as a whole are answered
+// with methods of all registered handlers.
+func (r *Router) ServeHTTP(w ResponseWriter, req *Request) {
+	if req.Method == "OPTIONS" && req.URL.Path == "*" {
+		chain(optionsHandler(r.routes.allMethods()), r.middleware)(w, req)
+		return
+	}
+
+	route, pathValues := r.routes.find(routingPath(req.URL))
+	req.pathValues = pathValues
+
+	chain(route.methodHandler(req.Method), r.middleware)(w, req)
+}
+
+// withGroupMiddleware wraps the handler with middleware of the group and
+// groups it was created from. Middleware is looked up on every request, so
+// it can be added after handlers.
+func (r *Router) withGroupMiddleware(handler RequestHandler) RequestHandler {
+	if r.parent == nil {
+		// middleware of the router dispatching the request is applied in ServeHTTP
+		return handler
+	}
+
+	return func(w ResponseWriter, req *Request) {
+		wrapped := handler
+		for group := r; group.parent != nil; group = group.parent {
+			wrapped = chain(wrapped, group.middleware)
+		}
+
+		wrapped(w, req)
+	}
+}
+
+// routingPath returns the path of the URL with its segments decoded, apart
+// from escaped "/" and "%". That way "/files/a%2Fb" is still two segments,
+// with "a/b" as the value of the second one.
+func routingPath(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = segmentEscaper.Replace(unescaped)
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+var segmentEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// routeNode is a node of a radix tree holding registered paths. Static
+// parts of paths are stored in compressed prefixes, wildcards get nodes
+// of their own. Patterns may contain "{name}" wildcards matching a single
+// path segment and a trailing "{name...}" wildcard matching the rest of
+// the path, e.g. "/users/{id}/posts/{postID}" or "/static/{path...}".
+type routeNode struct {
+	prefix string
+
+	// static children start with distinct bytes, so at most one of them
+	// can match the path
+	static   []*routeNode
+	param    *routeNode
+	catchAll *routeNode
+
+	handlers   map[string]RequestHandler
+	paramNames []string
+
+	// mounted handles any method for the path and paths below it, unless
+	// there is a more specific route
+	mounted      *routeNode
+	mountHandler RequestHandler
+}
+
+// add registers the handler for the method and pattern. It panics on
+// invalid patterns and on handlers already registered.
+func (n *routeNode) add(method, pattern string, handler RequestHandler) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("invalid pattern %q: must start with /", pattern))
+	}
+
+	node := n
+	var names []string
+
+	for rest := pattern; rest != ""; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			node = node.addStatic(rest)
+			break
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end < start || start == 0 || rest[start-1] != '/' || (end+1 < len(rest) && rest[end+1] != '/') {
+			panic(fmt.Sprintf("invalid pattern %q: wildcards must be whole path segments", pattern))
+		}
+
+		node = node.addStatic(rest[:start])
+		name := rest[start+1 : end]
+		rest = rest[end+1:]
+
+		if catchAllName, ok := strings.CutSuffix(name, "..."); ok {
+			if rest != "" {
+				panic(fmt.Sprintf("invalid pattern %q: %s must be at the end", pattern, name))
+			}
+
+			if node.catchAll == nil {
+				node.catchAll = &routeNode{}
+			}
+			node = node.catchAll
+			name = catchAllName
+		} else {
+			if node.param == nil {
+				node.param = &routeNode{}
+			}
+			node = node.param
+		}
+
+		if name == "" || slices.Contains(names, name) {
+			panic(fmt.Sprintf("invalid pattern %q: wildcard names must be non empty and unique", pattern))
+		}
+		names = append(names, name)
+	}
+
+	if _, ok := node.handlers[method]; ok {
+		panic("Handler for this method and path already registered")
+	}
+
+	if node.handlers == nil {
+		node.handlers = make(map[string]RequestHandler)
+		node.paramNames = names
+	} else if !slices.Equal(node.paramNames, names) {
+		panic(fmt.Sprintf("invalid pattern %q: wildcard names differ from %v registered for the path", pattern, node.paramNames))
+	}
+
+	node.handlers[method] = handler
+}
+
+// mount registers the handler for any method of the static prefix and
+// paths below it.
+func (n *routeNode) mount(prefix string, handler RequestHandler) {
+	if strings.Contains(prefix, "{") || (prefix != "" && !strings.HasPrefix(prefix, "/")) {
+		panic(fmt.Sprintf("invalid mount prefix %q: must be a static path", prefix))
+	}
+
+	node := n.addStatic(prefix)
+	if node.mounted != nil {
+		panic("Handler for this prefix already mounted")
+	}
+
+	node.mounted = &routeNode{mountHandler: handler}
+}
+
+// addStatic returns the node for the static path below n, splitting
+// prefixes of existing nodes where needed.
+func (n *routeNode) addStatic(path string) *routeNode {
+	// routing paths keep "%" escaped
+	path = strings.ReplaceAll(path, "%", "%25")
+	node := n
+
+	for path != "" {
+		child := node.staticChild(path[0])
+		if child == nil {
+			child = &routeNode{prefix: path}
+			node.static = append(node.static, child)
+			return child
+		}
+
+		common := commonPrefixLen(child.prefix, path)
+		if common < len(child.prefix) {
+			split := &routeNode{
+				prefix: child.prefix[:common],
+				static: []*routeNode{child},
+			}
+			child.prefix = child.prefix[common:]
+
+			node.static[slices.Index(node.static, child)] = split
+			child = split
+		}
+
+		node = child
+		path = path[common:]
+	}
+
+	return node
+}
+
+func (n *routeNode) staticChild(first byte) *routeNode {
+	for _, child := range n.static {
+		if child.prefix[0] == first {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// find returns the node registered for the routing path together with
+// decoded values of its wildcards. Static parts take precedence over single
+// segment wildcards, which take precedence over catch-all ones.
+func (n *routeNode) find(path string) (*routeNode, map[string]string) {
+	node, values := n.match(path, nil)
+	if node == nil {
+		return nil, nil
+	}
+
+	var pathValues map[string]string
+	if len(values) > 0 {
+		pathValues = make(map[string]string, len(values))
+		for i, name := range node.paramNames {
+			value, err := url.PathUnescape(values[i])
+			if err != nil {
+				value = values[i]
+			}
+			pathValues[name] = value
+		}
+	}
+
+	return node, pathValues
+}
+
+// match looks for the node of the path remaining after the prefix of n.
+func (n *routeNode) match(path string, values []string) (*routeNode, []string) {
+	if path == "" && len(n.handlers) > 0 {
+		return n, values
+	}
+
+	if path != "" {
+		if child := n.staticChild(path[0]); child != nil && strings.HasPrefix(path, child.prefix) {
+			if node, values := child.match(path[len(child.prefix):], values); node != nil {
+				return node, values
+			}
+		}
+
+		if n.param != nil {
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+
+			if end > 0 {
+				if node, values := n.param.match(path[end:], append(values, path[:end])); node != nil {
+					return node, values
+				}
+			}
+		}
+	}
+
+	if n.mounted != nil && (path == "" || path[0] == '/') {
+		return n.mounted, values
+	}
+
+	if n.catchAll != nil && len(n.catchAll.handlers) > 0 {
+		return n.catchAll, append(values, path)
+	}
+
+	return nil, nil
+}
+
+// handler returns the handler registered for the method, n may be nil.
+func (n *routeNode) handler(method string) (RequestHandler, bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	handler, ok := n.handlers[method]
+	return handler, ok
+}
+
+// methodHandler returns the handler answering the method for the path of n.
+// HEAD falls back to GET and OPTIONS is answered automatically, unless
+// handlers for them are registered. Other methods get 405 if the path has
+// handlers for any method and 404 otherwise.
+func (n *routeNode) methodHandler(method string) RequestHandler {
+	if n == nil {
+		return NotFoundHandler
+	}
+
+	if n.mountHandler != nil {
+		return n.mountHandler
+	}
+
+	if handler, ok := n.handler(method); ok {
+		return handler
+	}
+
+	if method == "HEAD" {
+		// HEAD is answered like GET, just without the body
+		if handler, ok := n.handler("GET"); ok {
+			return handler
+		}
+	}
+
+	allow := allowedMethods(n.handlers)
+	if method == "OPTIONS" {
+		return optionsHandler(allow)
+	}
+
+	return func(w ResponseWriter, r *Request) {
+		w.Header().Set("Allow", allow)
+		MethodNotAllowedHandler(w, r)
+	}
+}
+
+// allMethods lists methods of handlers registered for any path below n.
+func (n *routeNode) allMethods() string {
+	handlers := make(map[string]RequestHandler)
+
+	var collect func(node *routeNode)
+	collect = func(node *routeNode) {
+		if node == nil {
+			return
+		}
+
+		for method, handler := range node.handlers {
+			handlers[method] = handler
+		}
+
+		for _, child := range node.static {
+			collect(child)
+		}
+		collect(node.param)
+		collect(node.catchAll)
+	}
+	collect(n)
+
+	return allowedMethods(handlers)
+}
+
+func optionsHandler(allow string) RequestHandler {
+	return func(w ResponseWriter, r *Request) {
+		w.Header().Set("Allow", allow)
+		_ = w.SetStatus(StatusNoContent)
+	}
+}
+
+// allowedMethods lists methods handlers are registered for, including ones
+// answered automatically.
+func allowedMethods(handlers map[string]RequestHandler) string {
+	methods := make([]string, 0, len(handlers)+2)
+	for method := range handlers {
+		methods = append(methods, method)
+	}
+
+	if _, ok := handlers["GET"]; ok && !slices.Contains(methods, "HEAD") {
+		methods = append(methods, "HEAD")
+	}
+	if !slices.Contains(methods, "OPTIONS") {
+		methods = append(methods, "OPTIONS")
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
@@ -0,0 +1,316 @@
+package http
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteNode_Find(t *testing.T) {
+	var routes routeNode
+
+	for _, pattern := range []string{
+		"/",
+		"/users",
+		"/users/new",
+		"/users/{id}",
+		"/users/{id}/posts/{postID}",
+		"/user-groups",
+		"/static/{path...}",
+		"/static/favicon.ico",
+		"/files/{name}",
+		"/100%",
+		"/{path...}",
+	} {
+		routes.add("GET", pattern, noOpHandler)
+	}
+
+	tests := []struct {
+		path       string
+		pathValues map[string]string
+	}{
+		{"/", nil},
+		{"/users", nil},
+		{"/users/new", nil},
+		{"/users/42", map[string]string{"id": "42"}},
+		{"/users/42/posts/7", map[string]string{"id": "42", "postID": "7"}},
+		{"/user-groups", nil},
+		{"/static/favicon.ico", nil},
+		{"/static/css/main.css", map[string]string{"path": "css/main.css"}},
+		{"/static/", map[string]string{"path": ""}},
+		{"/users/42/comments", map[string]string{"path": "users/42/comments"}},
+		{"/users/", map[string]string{"path": "users/"}},
+		{"/files/a%2Fb", map[string]string{"name": "a/b"}},
+		{"/files/100%25", map[string]string{"name": "100%"}},
+		{"/static/a%2Fb/c", map[string]string{"path": "a/b/c"}},
+		{"/100%25", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			node, pathValues := routes.find(tt.path)
+
+			assert.NotNil(t, node)
+			_, ok := node.handler("GET")
+			assert.True(t, ok)
+			assert.Equal(t, tt.pathValues, pathValues)
+		})
+	}
+}
+
+func TestRouteNode_NotFound(t *testing.T) {
+	var routes routeNode
+
+	routes.add("GET", "/users/{id}", noOpHandler)
+	routes.add("GET", "/static/{path...}", noOpHandler)
+
+	for _, path := range []string{"/users", "/users/", "/users/42/posts", "/stat", "*", ""} {
+		node, _ := routes.find(path)
+		assert.Nil(t, node, "path %q should not match", path)
+	}
+}
+
+func TestRouteNode_Methods(t *testing.T) {
+	var routes routeNode
+
+	routes.add("GET", "/users/{id}", noOpHandler)
+	routes.add("DELETE", "/users/{id}", noOpHandler)
+
+	node, _ := routes.find("/users/42")
+
+	_, ok := node.handler("DELETE")
+	assert.True(t, ok)
+	_, ok = node.handler("POST")
+	assert.False(t, ok)
+}
+
+func TestRouteNode_InvalidPatterns(t *testing.T) {
+	var routes routeNode
+	routes.add("GET", "/users/{id}", noOpHandler)
+
+	for _, pattern := range []string{
+		"users",
+		"/users/{id}",
+		"/users/{name}",
+		"/files/{name}.txt",
+		"/files/id-{id}",
+		"/files/{id",
+		"/files/{}",
+		"/files/{path...}/raw",
+		"/files/{id}/{id}",
+	} {
+		assert.Panics(t, func() { routes.add("GET", pattern, noOpHandler) }, "pattern %q", pattern)
+	}
+}
+
+func TestRouteNode_MethodHandler(t *testing.T) {
+	var routes routeNode
+
+	routes.add("POST", "/users", noOpHandler)
+	routes.add("GET", "/users/{id}", noOpHandler)
+	routes.add("DELETE", "/users/{id}", noOpHandler)
+	routes.add("OPTIONS", "/custom", func(w ResponseWriter, r *Request) {
+		_ = w.SetStatus(StatusTeapot)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{"registered", "POST", "/users", StatusOK, ""},
+		{"wrong method", "GET", "/users", StatusMethodNotAllowed, "OPTIONS, POST"},
+		{"wrong method with GET", "PUT", "/users/42", StatusMethodNotAllowed, "DELETE, GET, HEAD, OPTIONS"},
+		{"automatic options", "OPTIONS", "/users/42", StatusNoContent, "DELETE, GET, HEAD, OPTIONS"},
+		{"custom options", "OPTIONS", "/custom", StatusTeapot, ""},
+		{"wrong method with custom options", "GET", "/custom", StatusMethodNotAllowed, "OPTIONS"},
+		{"unknown path", "GET", "/posts", StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := setupResponseTest(t)
+			node, _ := routes.find(tt.path)
+
+			node.methodHandler(tt.method)(w, &Request{Method: tt.method})
+
+			if w.statusCode == 0 {
+				w.statusCode = StatusOK
+			}
+			assert.Equal(t, tt.expectedStatus, w.statusCode)
+			assert.Equal(t, tt.expectedAllow, w.Header().Get("Allow"))
+		})
+	}
+}
+
+func serveTest(t *testing.T, router *Router, method, path string) *responseWriter {
+	w, _ := setupResponseTest(t)
+
+	router.ServeHTTP(w, &Request{Method: method, URL: &url.URL{Path: path}})
+
+	return w
+}
+
+func TestRouter_Group(t *testing.T) {
+	router := NewRouter()
+
+	var trace []string
+
+	router.Use(tracingMiddleware(&trace, "root"))
+
+	api := router.Group("/api")
+	v1 := api.Group("/v1")
+	v1.AddHandler("GET", "/users/{id}", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "handler "+r.PathValue("id"))
+	}, tracingMiddleware(&trace, "route"))
+
+	// group middleware applies also to handlers registered before it
+	v1.Use(tracingMiddleware(&trace, "v1"))
+	api.Use(tracingMiddleware(&trace, "api"))
+
+	w := serveTest(t, router, "GET", "/api/v1/users/42")
+	assert.Equal(t, 0, w.statusCode)
+
+	expectedTrace := []string{
+		"root before", "api before", "v1 before", "route before",
+		"handler 42",
+		"route after", "v1 after", "api after", "root after",
+	}
+	assert.Equal(t, expectedTrace, trace)
+
+	trace = nil
+	w = serveTest(t, router, "GET", "/users/42")
+	assert.Equal(t, StatusNotFound, w.statusCode)
+	assert.Equal(t, []string{"root before", "root after"}, trace)
+}
+
+func TestRouter_Mount(t *testing.T) {
+	var trace []string
+
+	admin := NewRouter()
+	admin.Use(tracingMiddleware(&trace, "admin"))
+	admin.AddHandler("GET", "/", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "index "+r.URL.Path)
+	})
+	admin.AddHandler("GET", "/users/{id}", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "user "+r.PathValue("id")+" "+r.URL.Path)
+	})
+
+	router := NewRouter()
+	router.AddHandler("GET", "/admin/health", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "health")
+	})
+	router.Group("/internal").Mount("/admin/", admin)
+	router.Mount("/admin", admin)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+		expectedTrace  []string
+	}{
+		{"/admin/users/42", 0, []string{"admin before", "user 42 /users/42", "admin after"}},
+		{"/admin", 0, []string{"admin before", "index /", "admin after"}},
+		{"/admin/", 0, []string{"admin before", "index /", "admin after"}},
+		{"/internal/admin/users/7", 0, []string{"admin before", "user 7 /users/7", "admin after"}},
+		{"/admin/health", 0, []string{"health"}},
+		{"/admin/posts", StatusNotFound, []string{"admin before", "admin after"}},
+		{"/administrator", StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			trace = nil
+
+			w := serveTest(t, router, "GET", tt.path)
+
+			assert.Equal(t, tt.expectedStatus, w.statusCode)
+			assert.Equal(t, tt.expectedTrace, trace)
+		})
+	}
+
+	assert.Panics(t, func() { router.Mount("/admin", NewRouter()) })
+}
+
+func TestRouter_EscapedPath(t *testing.T) {
+	var values []string
+
+	admin := NewRouter()
+	admin.AddHandler("GET", "/users/{id}", func(w ResponseWriter, r *Request) {
+		values = append(values, r.PathValue("id"), r.URL.EscapedPath())
+	})
+
+	router := NewRouter()
+	router.AddHandler("GET", "/files/{name}", func(w ResponseWriter, r *Request) {
+		values = append(values, r.PathValue("name"))
+	})
+	router.Mount("/admin", admin)
+
+	for _, target := range []string{"/files/a%2Fb", "/files/caf%C3%A9", "/admin/users/a%2Fb"} {
+		requestURL, err := url.Parse(target)
+		assert.Nil(t, err)
+
+		w, _ := setupResponseTest(t)
+		router.ServeHTTP(w, &Request{Method: "GET", URL: requestURL})
+		assert.Equal(t, 0, w.statusCode, target)
+	}
+
+	assert.Equal(t, []string{"a/b", "café", "a/b", "/users/a%2Fb"}, values)
+}
+
+func TestRouter_MountMethodNotAllowed(t *testing.T) {
+	admin := NewRouter()
+	admin.AddHandler("POST", "/users", noOpHandler)
+
+	router := NewRouter()
+	router.Mount("/admin", admin)
+
+	w := serveTest(t, router, "GET", "/admin/users")
+
+	assert.Equal(t, StatusMethodNotAllowed, w.statusCode)
+	assert.Equal(t, "OPTIONS, POST", w.Header().Get("Allow"))
+}
+
+type counterHandler struct {
+	count int
+}
+
+func (h *counterHandler) ServeHTTP(w ResponseWriter, r *Request) {
+	h.count++
+	_ = w.SetStatus(StatusAccepted)
+}
+
+func TestRouter_Handle(t *testing.T) {
+	router := NewRouter()
+	counter := &counterHandler{}
+
+	var handler Handler = RequestHandler(noOpHandler)
+	router.Handle("GET", "/noop", handler)
+	router.Handle("POST", "/count", counter)
+
+	w := serveTest(t, router, "POST", "/count")
+	serveTest(t, router, "POST", "/count")
+
+	assert.Equal(t, StatusAccepted, w.statusCode)
+	assert.Equal(t, 2, counter.count)
+	assert.Equal(t, 0, serveTest(t, router, "GET", "/noop").statusCode)
+}
+
+func TestRouter_MountServer(t *testing.T) {
+	inner := NewServer()
+	inner.AddHandler("GET", "/users/{id}", func(w ResponseWriter, r *Request) {
+		_, _ = w.Write([]byte(r.PathValue("id")))
+	})
+
+	outer := NewServer()
+	outer.Mount("/inner", inner)
+
+	w, rd := setupResponseTest(t)
+	outer.ServeHTTP(w, &Request{Method: "GET", URL: &url.URL{Path: "/inner/users/42"}})
+	assert.Nil(t, w.finish())
+
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n42")))
+}
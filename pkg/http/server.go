@@ -1,20 +1,62 @@
 package http
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"io"
 	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/szykol/http/pkg/log"
 )
 
+const (
+	defaultIdleTimeout     = 60 * time.Second
+	defaultBodyReadTimeout = 60 * time.Second
+	defaultServerName      = "go-simple-server"
+)
+
 type Server struct {
-	handlers map[handlerIdentifier]RequestHandler
+	// IdleTimeout is the maximum amount of time to wait for the next request
+	// on a keep-alive connection. Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// BodyReadTimeout is the maximum amount of time to read request body,
+	// counted from the end of request headers. Zero means no timeout.
+	BodyReadTimeout time.Duration
+
+	// BufferPayload makes the server read the whole request body into
+	// Request.Payload before calling the handler.
+	BufferPayload bool
+
+	// Limits bounds the size of requests accepted by the server.
+	Limits ParserLimits
+
+	// ErrorHandler writes responses to requests rejected before reaching
+	// a handler, e.g. malformed ones or ones exceeding Limits. Defaults to
+	// DefaultErrorHandler.
+	ErrorHandler ErrorHandler
+
+	// ServerHeader is sent as the Server header of responses, unless the
+	// handler sets one. Empty value suppresses the header.
+	ServerHeader string
+
+	router     *Router
+	hosts      hostRouters
+	middleware []Middleware
 }
 
 func NewServer() *Server {
 	return &Server{
-		handlers: make(map[handlerIdentifier]RequestHandler),
+		IdleTimeout:     defaultIdleTimeout,
+		BodyReadTimeout: defaultBodyReadTimeout,
+		Limits:          DefaultParserLimits,
+		ServerHeader:    defaultServerName,
+		router:          NewRouter(),
 	}
 }
 
@@ -42,17 +84,59 @@ func (s *Server) Run(ctx context.Context, l net.Listener) {
 	}
 }
 
-func (s *Server) AddHandler(method, path string, requestHandler RequestHandler) {
-	ident := handlerIdentifier{
-		method: method,
-		path:   path,
-	}
+// AddHandler registers the handler for the method and path pattern, see
+// Router.AddHandler.
+func (s *Server) AddHandler(method, path string, requestHandler RequestHandler, middleware ...Middleware) {
+	s.router.AddHandler(method, path, requestHandler, middleware...)
+}
+
+// Handle registers the handler for the method and path pattern, see
+// Router.Handle.
+func (s *Server) Handle(method, path string, handler Handler, middleware ...Middleware) {
+	s.router.Handle(method, path, handler, middleware...)
+}
 
-	if _, ok := s.getHandler(ident); ok {
-		panic("Handler for this method and path already registered")
+// Use adds middleware wrapping every request handled by the server, also
+// ones answered with 404 or 405 and ones for hosts registered with Host.
+// Middleware runs in the order it is added, the first one is the outermost.
+// Requests rejected before reaching a handler, e.g. malformed ones, are not
+// passed through middleware.
+func (s *Server) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// Host returns the router for requests addressed to the host, either
+// through the Host header or the absolute-form request target. The pattern
+// is either a host name, e.g. "api.example.com", or a wildcard matching its
+// subdomains, e.g. "*.example.com". Exact host names take precedence over
+// wildcards, the longest wildcard wins and requests for other hosts are
+// handled by handlers registered directly on the server. Ports are
+// ignored.
+func (s *Server) Host(pattern string) *Router {
+	return s.hosts.router(pattern)
+}
+
+// Group returns a router registering handlers of the server under the
+// prefix, see Router.Group.
+func (s *Server) Group(prefix string) *Router {
+	return s.router.Group(prefix)
+}
+
+// Mount passes requests under the prefix to the handler, see Router.Mount.
+func (s *Server) Mount(prefix string, handler Handler) {
+	s.router.Mount(prefix, handler)
+}
+
+// ServeHTTP dispatches the request to the handlers of the server, so it can
+// be mounted in another server or router. Settings of the server related to
+// connections and responses, e.g. ServerHeader, don't apply then.
+func (s *Server) ServeHTTP(w ResponseWriter, r *Request) {
+	router, ok := s.hosts.match(r.Host)
+	if !ok {
+		router = s.router
 	}
 
-	s.handlers[ident] = requestHandler
+	chain(router.ServeHTTP, s.middleware)(w, r)
 }
 
 func listener(ctx context.Context, listener net.Listener, connChan chan<- net.Conn) {
@@ -71,52 +155,301 @@ func listener(ctx context.Context, listener net.Listener, connChan chan<- net.Co
 	close(connChan)
 }
 
-func (s *Server) handleNewConnection(ctx context.Context, rd io.ReadWriteCloser) {
-	defer rd.Close()
+func (s *Server) handleNewConnection(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
 
 	logger := log.FromContext(ctx)
 	logger.Debug("Handling new connection")
 
-	request, err := parseRequest(rd)
+	// unblock pending read when server is shutting down
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+
+	// responses have to be written in the same order requests came in,
+	// each one waits for the previous one to complete
+	prev := closedChan()
+	inFlight := make(chan struct{}, maxPipelinedRequests)
+
+	for {
+		if err := s.waitForRequest(ctx, conn, reader, prev); err != nil {
+			if !isConnectionDone(err) {
+				logger.Errorw("Error waiting for request", "err", err)
+			}
+			logger.Debug("Closing idle connection")
+			break
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		request, err := parseRequest(reader, s.Limits)
+		if isConnectionDone(err) {
+			logger.Debug("Connection closed")
+			break
+		}
+		if err != nil {
+			logger.Errorw("Error parsing request", "request", request, "err", err)
+
+			// framing of anything after malformed request is unknown,
+			// respond and give up on the connection
+			writer := newPipelinedWriter(conn, prev)
+			prev = writer.done
+
+			s.writeError(ctx, writer, parseErrorStatus(err), err)
+			if err := writer.finish(); err != nil {
+				logger.Errorw("Error writing response", "err", err)
+			}
+			break
+		}
+
+		// idle timeout only covers the wait for the next request
+		if err := setReadTimeout(ctx, conn, s.BodyReadTimeout); err != nil {
+			logger.Errorw("Error setting read deadline", "err", err)
+			break
+		}
+
+		writer := newPipelinedWriter(conn, prev)
+		prev = writer.done
+
+		if request.body != nil && request.body.awaitingContinue {
+			request.body.writeContinue = func() error {
+				return writer.writeInterim([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+			}
+		}
+
+		inFlight <- struct{}{}
+		go func() {
+			defer func() { <-inFlight }()
+
+			s.serveRequest(ctx, &request, writer)
+		}()
+
+		// next request starts where this body ends
+		if request.body != nil {
+			<-request.body.done
+			if request.body.incomplete {
+				logger.Debug("Closing connection with unread request body")
+				break
+			}
+		}
+
+		if !shouldKeepAlive(&request) {
+			logger.Debug("Closing connection on client request")
+			break
+		}
+	}
+
+	// wait for pending responses before closing connection
+	<-prev
+}
+
+// waitForRequest blocks until the next request starts arriving. The
+// connection is idle only once all previous responses are sent, so idle
+// timeout starts counting then, not while a handler is still running.
+// Request headers have to arrive within the idle timeout too.
+func (s *Server) waitForRequest(ctx context.Context, conn net.Conn, reader *bufio.Reader, prev <-chan struct{}) error {
+	var mu sync.Mutex
+	waiting := true
+
+	select {
+	case <-prev:
+		if err := setReadTimeout(ctx, conn, s.IdleTimeout); err != nil {
+			return err
+		}
+	default:
+		if err := setReadTimeout(ctx, conn, 0); err != nil {
+			return err
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-prev:
+			case <-stop:
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if waiting {
+				_ = setReadTimeout(ctx, conn, s.IdleTimeout)
+			}
+		}()
+	}
+
+	_, err := reader.Peek(1)
+
+	mu.Lock()
+	waiting = false
+	mu.Unlock()
+
 	if err != nil {
-		logger.Errorw("Error parsing request", "request", request, "err", err)
-		return
+		return err
 	}
 
-	s.handleRequest(ctx, &request, rd)
+	return setReadTimeout(ctx, conn, s.IdleTimeout)
+}
+
+// isConnectionDone reports whether the error means the client is gone or
+// the connection was closed on purpose, e.g. on timeout or after
+// a response with "Connection: close".
+func isConnectionDone(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe)
 }
 
-func (s *Server) handleRequest(ctx context.Context, request *Request, rd io.ReadWriter) {
-	ident := handlerIdentifier{
-		path:   request.path,
-		method: request.Method,
+// setReadTimeout sets read deadline of the connection timeout from now,
+// zero timeout means no deadline.
+func setReadTimeout(ctx context.Context, conn net.Conn, timeout time.Duration) error {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
 	}
 
-	handler, ok := s.getHandler(ident)
-	if !ok {
-		handler = NotFoundHandler
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return err
 	}
 
-	requestWriter := newResponseWriter(rd)
+	// don't undo the deadline set on shutdown
+	if ctx.Err() != nil {
+		return conn.SetReadDeadline(time.Now())
+	}
 
-	handle(ctx, handler, requestWriter, request)
+	return nil
 }
 
-func handle(ctx context.Context, h RequestHandler, w ResponseWriter, req *Request) {
+// shouldKeepAlive reports whether the connection can be reused after
+// responding to the request. HTTP/1.1 connections are persistent unless
+// the client asks otherwise, HTTP/1.0 ones only on explicit request.
+func shouldKeepAlive(request *Request) bool {
+	connection := strings.Join(request.Headers.Values("Connection"), ",")
+
+	switch request.Proto {
+	case "HTTP/1.1":
+		return !hasToken(connection, "close")
+	case "HTTP/1.0":
+		return hasToken(connection, "keep-alive")
+	default:
+		return false
+	}
+}
+
+func hasToken(value, token string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) serveRequest(ctx context.Context, request *Request, writer *pipelinedWriter) {
+	logger := log.FromContext(ctx)
+
+	// response goes out before the rest of the body is drained
+	defer request.Body.Close()
 	defer func() {
-		if r := recover(); r != nil {
-			logger := log.FromContext(ctx)
-			logger.Errorw("Error when handling request")
-			InternalServerErrorHandler(w, req)
+		if err := writer.finish(); err != nil {
+			logger.Errorw("Error writing response", "err", err)
 		}
 	}()
 
-	h(w, req)
+	if s.BufferPayload {
+		payload, err := readPayload(request)
+		if err != nil {
+			// don't dispatch half-read requests to handlers
+			logger.Errorw("Error reading request body", "err", err)
+
+			s.writeError(ctx, writer, parseErrorStatus(err), err)
+			return
+		}
+
+		request.Payload = payload
+	}
+
+	s.handleRequest(ctx, request, writer)
+}
+
+// parseErrorStatus maps errors returned by the parser to response status
+// codes.
+func parseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errRequestLineTooLong):
+		return StatusURITooLong
+	case errors.Is(err, errHeadersTooLarge):
+		return StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, errBodyTooLarge):
+		return StatusContentTooLarge
+	case errors.Is(err, errUnsupportedTransferEncoding):
+		return StatusNotImplemented
+	case errors.Is(err, errUnsupportedProto):
+		return StatusHTTPVersionNotSupported
+	case errors.Is(err, errUnsupportedExpectation):
+		return StatusExpectationFailed
+	default:
+		return StatusBadRequest
+	}
+}
+
+// writeError responds to a request rejected before reaching a handler.
+// The connection is closed afterwards.
+func (s *Server) writeError(ctx context.Context, w io.Writer, statusCode int, err error) {
+	errorHandler := s.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = DefaultErrorHandler
+	}
+
+	responseWriter := newResponseWriter(ctx, w)
+	responseWriter.serverName = s.ServerHeader
+
+	handle(ctx, func(w ResponseWriter, _ *Request) {
+		errorHandler(w, statusCode, err)
+	}, responseWriter, nil)
+}
+
+func (s *Server) handleRequest(ctx context.Context, request *Request, rd io.Writer) {
+	requestWriter := newResponseWriter(ctx, rd)
+	requestWriter.keepAlive = shouldKeepAlive(request)
+	requestWriter.canChunk = request.Proto == "HTTP/1.1"
+	requestWriter.serverName = s.ServerHeader
+	requestWriter.discardBody = request.Method == "HEAD"
+	requestWriter.requestBody = request.body
+
+	handle(ctx, s.ServeHTTP, requestWriter, request)
 }
 
-func (s *Server) getHandler(handlerIdentifier handlerIdentifier) (RequestHandler, bool) {
-	// NOTE: assuming this will get more complicated over time
+func handle(ctx context.Context, h RequestHandler, w *responseWriter, req *Request) {
+	logger := log.FromContext(ctx)
+
+	defer func() {
+		if err := w.finish(); err != nil {
+			logger.Errorw("Error writing response", "err", err)
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorw("Error when handling request", "panic", r)
 
-	handler, ok := s.handlers[handlerIdentifier]
-	return handler, ok
+			// replace whatever handler managed to write before panicking
+			if w.reset() {
+				InternalServerErrorHandler(w, req)
+			} else {
+				w.abort()
+			}
+		}
+	}()
+
+	h(w, req)
 }
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/url"
+	"regexp"
 	"testing"
 	"time"
 
@@ -22,6 +24,14 @@ type serverTestF struct {
 
 func noOpHandler(ResponseWriter, *Request) {}
 
+var dateHeader = regexp.MustCompile("Date: [^\r]*\r\n")
+
+// withFixedDate replaces the value of Date header, which changes with
+// every response, so responses can be compared.
+func withFixedDate(response string) string {
+	return dateHeader.ReplaceAllString(response, "Date: Thu, 01 Jan 2026 00:00:00 GMT\r\n")
+}
+
 func setupServerTest(t *testing.T) serverTestF {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*30)
 	logger := log.NewLogger(log.NewZapCfg())
@@ -40,6 +50,14 @@ func setupServerTest(t *testing.T) serverTestF {
 	}
 }
 
+func TestNewServerTimeouts(t *testing.T) {
+	server := NewServer()
+
+	assert.Equal(t, defaultIdleTimeout, server.IdleTimeout)
+	assert.Equal(t, defaultBodyReadTimeout, server.BodyReadTimeout)
+	assert.NotZero(t, server.BodyReadTimeout, "Stalled request body should not hold the connection forever")
+}
+
 func TestAddHandler(t *testing.T) {
 	f := setupServerTest(t)
 
@@ -60,17 +78,306 @@ func TestHandleRequest(t *testing.T) {
 	})
 
 	request := &Request{
-		path:   "/test",
+		URL:    &url.URL{Path: "/test"},
 		Method: "POST",
+		Proto:  "HTTP/1.1",
 	}
 
 	rd := &bytes.Buffer{}
 
 	f.server.handleRequest(f.ctx, request, rd)
 
-	expectedResponse := []byte("HTTP/1.1 200 OK\r\nContent-Length: 9\r\nContent-Type: application/x-www-form-urlencoded\r\nConnection: Keep-Alive\r\nServer: go-simple-server\r\n\r\nunit test")
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 9\r\nContent-Type: text/plain; charset=utf-8\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\n\r\nunit test"
 
-	assert.Equal(t, expectedResponse, rd.Bytes())
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestHandleRequestCustomHeaders(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/test", func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		w.Header().Set("Server", "unit-test")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("Cache-Control", "no-store")
+
+		_, err := w.Write([]byte("{}"))
+		assert.Nil(t, err, "Handler should not return error")
+	})
+
+	request := &Request{
+		URL:    &url.URL{Path: "/test"},
+		Method: "GET",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nCache-Control: no-store\r\nConnection: Keep-Alive\r\nContent-Length: 2\r\nContent-Type: application/vnd.api+json\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: unit-test\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\n{}"
+
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestHandleRequestServerHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverHeader string
+		expected     string
+	}{
+		{"custom", "unit-test/1.0", "Server: unit-test/1.0\r\n"},
+		{"suppressed", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := setupServerTest(t)
+			f.server.ServerHeader = tt.serverHeader
+			f.server.AddHandler("GET", "/test", noOpHandler)
+
+			request := &Request{
+				URL:    &url.URL{Path: "/test"},
+				Method: "GET",
+				Proto:  "HTTP/1.1",
+			}
+
+			rd := &bytes.Buffer{}
+
+			f.server.handleRequest(f.ctx, request, rd)
+
+			expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 0\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\n" + tt.expected + "\r\n"
+			assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+		})
+	}
+}
+
+func TestHandleRequestHeadFallsBackToGet(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/test", func(w ResponseWriter, r *Request) {
+		_, err := w.Write([]byte("unit test"))
+		assert.Nil(t, err, "Handler should not return error")
+	})
+
+	request := &Request{
+		URL:    &url.URL{Path: "/test"},
+		Method: "HEAD",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 9\r\nContent-Type: text/plain; charset=utf-8\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\n\r\n"
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func TestHandleRequestHeadHandler(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/test", func(w ResponseWriter, r *Request) {
+		_ = w.SetStatus(StatusTeapot)
+	})
+	f.server.AddHandler("HEAD", "/test", func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("ignored"))
+	})
+
+	request := &Request{
+		URL:    &url.URL{Path: "/test"},
+		Method: "HEAD",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, rd.String(), "Content-Length: 100\r\n")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n")), "Body should not be sent")
+}
+
+func TestHandleRequestPathValues(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/users/{id}/posts/{postID}", func(w ResponseWriter, r *Request) {
+		_, _ = fmt.Fprintf(w, "%s:%s:%q", r.PathValue("id"), r.PathValue("postID"), r.PathValue("missing"))
+	})
+
+	request := &Request{
+		URL:    &url.URL{Path: "/users/42/posts/7"},
+		Method: "GET",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 200 OK\r\n")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n42:7:\"\"")))
+}
+
+func TestHandleRequestMethodNotAllowed(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("POST", "/test", noOpHandler)
+
+	request := &Request{
+		URL:    &url.URL{Path: "/test"},
+		Method: "GET",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	expectedResponse := "HTTP/1.1 405 Method Not Allowed\r\nAllow: OPTIONS, POST\r\nConnection: Keep-Alive\r\nContent-Length: 0\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: go-simple-server\r\n\r\n"
+	assert.Equal(t, expectedResponse, withFixedDate(rd.String()))
+}
+
+func tracingMiddleware(trace *[]string, name string) Middleware {
+	return func(next RequestHandler) RequestHandler {
+		return func(w ResponseWriter, r *Request) {
+			*trace = append(*trace, name+" before")
+			next(w, r)
+			*trace = append(*trace, name+" after")
+		}
+	}
+}
+
+func TestHandleRequestMiddleware(t *testing.T) {
+	f := setupServerTest(t)
+
+	var trace []string
+
+	f.server.Use(tracingMiddleware(&trace, "global1"), tracingMiddleware(&trace, "global2"))
+	f.server.AddHandler("GET", "/test", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "handler")
+	}, tracingMiddleware(&trace, "route1"), tracingMiddleware(&trace, "route2"))
+
+	request := &Request{
+		URL:    &url.URL{Path: "/test"},
+		Method: "GET",
+		Proto:  "HTTP/1.1",
+	}
+
+	f.server.handleRequest(f.ctx, request, &bytes.Buffer{})
+
+	expectedTrace := []string{
+		"global1 before", "global2 before", "route1 before", "route2 before",
+		"handler",
+		"route2 after", "route1 after", "global2 after", "global1 after",
+	}
+	assert.Equal(t, expectedTrace, trace)
+}
+
+func TestHandleRequestMiddlewareNotFound(t *testing.T) {
+	f := setupServerTest(t)
+
+	var trace []string
+
+	f.server.Use(tracingMiddleware(&trace, "global"))
+	f.server.AddHandler("GET", "/test", noOpHandler, tracingMiddleware(&trace, "route"))
+
+	request := &Request{
+		URL:    &url.URL{Path: "/nonexistent"},
+		Method: "GET",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 404 Not Found")
+	assert.Equal(t, []string{"global before", "global after"}, trace)
+}
+
+func TestHandleRequestHost(t *testing.T) {
+	f := setupServerTest(t)
+
+	var trace []string
+
+	f.server.Use(tracingMiddleware(&trace, "global"))
+	f.server.AddHandler("GET", "/", func(w ResponseWriter, r *Request) {
+		_, _ = w.Write([]byte("default"))
+	})
+	f.server.Host("api.example.com").AddHandler("GET", "/", func(w ResponseWriter, r *Request) {
+		_, _ = w.Write([]byte("api"))
+	})
+	f.server.Host("*.example.com").AddHandler("GET", "/", func(w ResponseWriter, r *Request) {
+		_, _ = w.Write([]byte("wildcard"))
+	})
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"api.example.com:1337", "api"},
+		{"www.example.com", "wildcard"},
+		{"example.com", "default"},
+		{"", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			trace = nil
+
+			request := &Request{
+				URL:    &url.URL{Path: "/"},
+				Host:   tt.host,
+				Method: "GET",
+				Proto:  "HTTP/1.1",
+			}
+
+			rd := &bytes.Buffer{}
+
+			f.server.handleRequest(f.ctx, request, rd)
+
+			assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n"+tt.expected)))
+			assert.Equal(t, []string{"global before", "global after"}, trace)
+		})
+	}
+}
+
+func TestHandleRequestOptionsAsterisk(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/users/{id}", noOpHandler)
+	f.server.AddHandler("POST", "/users", noOpHandler)
+	f.server.Host("api.example.com").AddHandler("DELETE", "/users/{id}", noOpHandler)
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"example.com", "Allow: GET, HEAD, OPTIONS, POST\r\n"},
+		{"api.example.com", "Allow: DELETE, OPTIONS\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			request := &Request{
+				URL:    &url.URL{Path: "*"},
+				Host:   tt.host,
+				Method: "OPTIONS",
+				Proto:  "HTTP/1.1",
+			}
+
+			rd := &bytes.Buffer{}
+
+			f.server.handleRequest(f.ctx, request, rd)
+
+			assert.Contains(t, rd.String(), "HTTP/1.1 204 No Content\r\n")
+			assert.Contains(t, rd.String(), tt.expected)
+		})
+	}
 }
 
 func TestHandleRequestHandlerNotFound(t *testing.T) {
@@ -82,7 +389,7 @@ func TestHandleRequestHandlerNotFound(t *testing.T) {
 	})
 
 	request := &Request{
-		path:   "/nonexistent",
+		URL:    &url.URL{Path: "/nonexistent"},
 		Method: "POST",
 	}
 
@@ -93,6 +400,31 @@ func TestHandleRequestHandlerNotFound(t *testing.T) {
 	assert.Contains(t, rd.String(), "HTTP/1.1 404 Not Found")
 }
 
+func TestHandleRequestWithQuery(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/test", func(w ResponseWriter, r *Request) {
+		_, err := w.Write([]byte(r.URL.Query().Get("x")))
+		assert.Nil(t, err, "Handler should not return error")
+	})
+
+	requestURL, err := url.ParseRequestURI("/test?x=1")
+	assert.Nil(t, err)
+
+	request := &Request{
+		URL:    requestURL,
+		Method: "GET",
+		Proto:  "HTTP/1.1",
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 200 OK")
+	assert.True(t, bytes.HasSuffix(rd.Bytes(), []byte("\r\n\r\n1")))
+}
+
 func TestHandleRequestInternalServerError(t *testing.T) {
 	f := setupServerTest(t)
 
@@ -101,7 +433,7 @@ func TestHandleRequestInternalServerError(t *testing.T) {
 	})
 
 	request := &Request{
-		path:   "/test",
+		URL:    &url.URL{Path: "/test"},
 		Method: "POST",
 	}
 
@@ -112,6 +444,53 @@ func TestHandleRequestInternalServerError(t *testing.T) {
 	assert.Contains(t, rd.String(), "HTTP/1.1 500 Internal Server Error")
 }
 
+func TestHandleRequestConnectionClose(t *testing.T) {
+	f := setupServerTest(t)
+
+	f.server.AddHandler("GET", "/test", func(w ResponseWriter, r *Request) {
+		_, err := w.Write([]byte("unit test"))
+		assert.Nil(t, err, "Handler should not return error")
+	})
+
+	request := &Request{
+		URL:     &url.URL{Path: "/test"},
+		Method:  "GET",
+		Proto:   "HTTP/1.1",
+		Headers: Header{"Connection": {"close"}},
+	}
+
+	rd := &bytes.Buffer{}
+
+	f.server.handleRequest(f.ctx, request, rd)
+
+	assert.Contains(t, rd.String(), "Connection: close\r\n")
+}
+
+func TestShouldKeepAlive(t *testing.T) {
+	testCases := []struct {
+		proto      string
+		connection string
+		expected   bool
+	}{
+		{proto: "HTTP/1.1", expected: true},
+		{proto: "HTTP/1.1", connection: "keep-alive", expected: true},
+		{proto: "HTTP/1.1", connection: "close", expected: false},
+		{proto: "HTTP/1.1", connection: "upgrade, Close", expected: false},
+		{proto: "HTTP/1.0", expected: false},
+		{proto: "HTTP/1.0", connection: "keep-alive", expected: true},
+		{proto: "HTTP/0.9", connection: "keep-alive", expected: false},
+	}
+
+	for _, tc := range testCases {
+		request := &Request{
+			Proto:   tc.proto,
+			Headers: Header{"Connection": {tc.connection}},
+		}
+
+		assert.Equal(t, tc.expected, shouldKeepAlive(request), "proto: %s, connection: %s", tc.proto, tc.connection)
+	}
+}
+
 // Wait for conn on channel or handle test timeout, whichever happens first
 func getNextConn(t *testing.T, f serverTestF, c chan net.Conn) (net.Conn, bool) {
 	select {
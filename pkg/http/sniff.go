@@ -0,0 +1,72 @@
+package http
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of the body is looked at to detect its type.
+const sniffLen = 512
+
+var signatures = []struct {
+	prefix      []byte
+	contentType string
+}{
+	{prefix: []byte("\x89PNG\r\n\x1a\n"), contentType: "image/png"},
+	{prefix: []byte("\xff\xd8\xff"), contentType: "image/jpeg"},
+	{prefix: []byte("GIF87a"), contentType: "image/gif"},
+	{prefix: []byte("GIF89a"), contentType: "image/gif"},
+	{prefix: []byte("%PDF-"), contentType: "application/pdf"},
+	{prefix: []byte("\x1f\x8b\x08"), contentType: "application/x-gzip"},
+	{prefix: []byte("PK\x03\x04"), contentType: "application/zip"},
+}
+
+// detectContentType guesses the content type of a response body from its
+// first bytes. It only knows a handful of common formats and falls back to
+// plain text or binary data. Formats which can't be told by their prefix,
+// like JSON, are not guessed, handlers have to set Content-Type for them.
+func detectContentType(data []byte) string {
+	for _, signature := range signatures {
+		if bytes.HasPrefix(data, signature.prefix) {
+			return signature.contentType
+		}
+	}
+
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+
+	if !isText(data) {
+		return "application/octet-stream"
+	}
+
+	trimmed := bytes.ToLower(bytes.TrimLeft(data, " \t\r\n"))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<!doctype html")), bytes.HasPrefix(trimmed, []byte("<html")):
+		return "text/html; charset=utf-8"
+	case bytes.HasPrefix(trimmed, []byte("<?xml")):
+		return "text/xml; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+func isText(data []byte) bool {
+	// body might be cut in the middle of a multi byte character
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+
+	if !utf8.Valid(data) {
+		return false
+	}
+
+	for _, c := range data {
+		isControl := c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f'
+		if isControl || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContentType(t *testing.T) {
+	testCases := []struct {
+		data     string
+		expected string
+	}{
+		{data: "", expected: "text/plain; charset=utf-8"},
+		{data: "unit test", expected: "text/plain; charset=utf-8"},
+		{data: "zażółć gęślą jaźń", expected: "text/plain; charset=utf-8"},
+		{data: "  <!DOCTYPE html><html></html>", expected: "text/html; charset=utf-8"},
+		{data: "<html><body></body></html>", expected: "text/html; charset=utf-8"},
+		{data: "<?xml version=\"1.0\"?><a/>", expected: "text/xml; charset=utf-8"},
+		{data: "{\"test\":\"value\"}", expected: "text/plain; charset=utf-8"},
+		{data: "[1, 2, 3]", expected: "text/plain; charset=utf-8"},
+		{data: "{\"test\":\"" + strings.Repeat("a", sniffLen) + "\"}", expected: "text/plain; charset=utf-8"},
+		{data: "<html>" + strings.Repeat("a", sniffLen) + "</html>", expected: "text/html; charset=utf-8"},
+		{data: "\x89PNG\r\n\x1a\n\x00\x00", expected: "image/png"},
+		{data: "%PDF-1.7", expected: "application/pdf"},
+		{data: "\x00\x01\x02\x03", expected: "application/octet-stream"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, detectContentType([]byte(tc.data)), "data: %q", tc.data)
+	}
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusText(t *testing.T) {
+	tests := []struct {
+		code     int
+		expected string
+	}{
+		{StatusOK, "OK"},
+		{StatusMovedPermanently, "Moved Permanently"},
+		{StatusNotModified, "Not Modified"},
+		{StatusMethodNotAllowed, "Method Not Allowed"},
+		{StatusTooManyRequests, "Too Many Requests"},
+		{StatusServiceUnavailable, "Service Unavailable"},
+		{299, ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, StatusText(tt.code), "status %d", tt.code)
+	}
+}
+
+func TestRegisterStatusText(t *testing.T) {
+	t.Cleanup(func() {
+		customStatusTextMu.Lock()
+		defer customStatusTextMu.Unlock()
+		delete(customStatusText, 299)
+	})
+
+	assert.Nil(t, RegisterStatusText(299, "Custom Success"))
+	assert.Equal(t, "Custom Success", StatusText(299))
+
+	assert.ErrorIs(t, RegisterStatusText(600, "Too Big"), ErrInvalidStatusCode)
+	assert.Error(t, RegisterStatusText(299, "Split\r\nHeader: injected"))
+	assert.Equal(t, "Custom Success", StatusText(299))
+}
+
+func TestResponseWriter_InvalidStatus(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	assert.ErrorIs(t, w.SetStatus(99), ErrInvalidStatusCode)
+	assert.ErrorIs(t, w.SetStatus(600), ErrInvalidStatusCode)
+	assert.Nil(t, w.SetStatus(StatusNoContent))
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 204 No Content\r\n")
+}
+
+func TestResponseWriter_UnknownStatus(t *testing.T) {
+	w, rd := setupResponseTest(t)
+
+	assert.Nil(t, w.SetStatus(299))
+	assert.Nil(t, w.finish())
+
+	assert.Contains(t, rd.String(), "HTTP/1.1 299 \r\n")
+}